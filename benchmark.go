@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// benchmarkTablePrefix starts the name of the scratch destination table the benchmark
+// inserts into, which is made unique per run so no existing table is touched
+const benchmarkTablePrefix = "migrate_benchmark_"
+
+// benchmarkColumn is a benchmark column type and the generator of its synthetic values
+type benchmarkColumn struct {
+	columnType string
+	value      func(rng *rand.Rand) interface{}
+}
+
+// benchmarkColumnTypes maps the -benchmarkColumns names to their columns
+var benchmarkColumnTypes = map[string]benchmarkColumn{
+	"int":      {"INT", func(rng *rand.Rand) interface{} { return rng.Int31() }},
+	"bigint":   {"BIGINT", func(rng *rand.Rand) interface{} { return rng.Int63() }},
+	"double":   {"DOUBLE", func(rng *rand.Rand) interface{} { return rng.Float64() }},
+	"decimal":  {"DECIMAL(12,2)", func(rng *rand.Rand) interface{} { return float64(rng.Intn(1e11)) / 100 }},
+	"varchar":  {"VARCHAR(255)", func(rng *rand.Rand) interface{} { return benchmarkString(rng, 32) }},
+	"text":     {"TEXT", func(rng *rand.Rand) interface{} { return benchmarkString(rng, 1024) }},
+	"datetime": {"DATETIME", func(rng *rand.Rand) interface{} { return time.Unix(rng.Int63n(2e9), 0).UTC() }},
+}
+
+// benchmarkString returns a random lowercase string of the given length
+func benchmarkString(rng *rand.Rand, length int) string {
+	b := make([]byte, length)
+	for i := range b {
+		b[i] = byte('a' + rng.Intn(26))
+	}
+	return string(b)
+}
+
+// runBenchmark inserts rowCount synthetic rows with the given column types into a
+// scratch destination table once per transaction size and reports the throughput of
+// each run. The rows go through the same prepared statement and destWriter as a
+// migration, with the -destInitSQL session of opts, so only source read cost is left
+// out. The table is dropped afterwards.
+func runBenchmark(ctx context.Context, dstDB *sql.DB, columnTypes []string, rowCount int, txSizes []int, opts migrationOptions) error {
+	if len(columnTypes) == 0 {
+		return fmt.Errorf("no benchmark columns given")
+	}
+	definitions := []string{"`id` INT NOT NULL PRIMARY KEY"}
+	quotedCols := []string{"`id`"}
+	for i, name := range columnTypes {
+		column, ok := benchmarkColumnTypes[name]
+		if !ok {
+			return fmt.Errorf("unknown benchmark column type '%s'", name)
+		}
+		definitions = append(definitions, fmt.Sprintf("`c%d` %s", i+1, column.columnType))
+		quotedCols = append(quotedCols, fmt.Sprintf("`c%d`", i+1))
+	}
+
+	// CREATE TABLE without IF NOT EXISTS fails rather than reuse a table of that name,
+	// so only the table created here is ever emptied and dropped
+	table := fmt.Sprintf("%s%d", benchmarkTablePrefix, time.Now().UnixNano())
+	createTableSQL := fmt.Sprintf("CREATE TABLE %s (%s)", table, strings.Join(definitions, ", "))
+	if _, err := dstDB.ExecContext(ctx, createTableSQL); err != nil {
+		return fmt.Errorf("failed to create benchmark table: %v", err)
+	}
+	defer dstDB.Exec(fmt.Sprintf("DROP TABLE %s", table))
+
+	insertStmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(quotedCols, ", "), placeholders(dialectMySQL, len(quotedCols)))
+	fmt.Printf("Benchmarking %d rows of (%s) in '%s'\n", rowCount, strings.Join(columnTypes, ", "), table)
+	for _, txSize := range txSizes {
+		opts.rowsPerTransaction = txSize
+		elapsed, err := benchmarkRun(ctx, dstDB, table, insertStmt, columnTypes, rowCount, opts)
+		if err != nil {
+			return fmt.Errorf("rowsPerTransaction=%d: %v", txSize, err)
+		}
+		fmt.Printf("rowsPerTransaction=%d: %d rows in %s (%.0f rows/sec)\n", txSize, rowCount, elapsed.Round(time.Millisecond), float64(rowCount)/elapsed.Seconds())
+	}
+	return nil
+}
+
+// benchmarkRun empties the benchmark table and times one insert run into it
+func benchmarkRun(ctx context.Context, dstDB *sql.DB, table, insertStmt string, columnTypes []string, rowCount int, opts migrationOptions) (time.Duration, error) {
+	if _, err := dstDB.ExecContext(ctx, fmt.Sprintf("TRUNCATE TABLE %s", table)); err != nil {
+		return 0, fmt.Errorf("error emptying benchmark table: %v", err)
+	}
+
+	writer, err := openDestWriter(ctx, dstDB, insertStmt, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer writer.close()
+
+	// A fixed seed keeps the data identical between runs
+	rng := rand.New(rand.NewSource(1))
+	values := make([]interface{}, len(columnTypes)+1)
+	start := time.Now()
+	for row := 1; row <= rowCount; row++ {
+		values[0] = row
+		for i, name := range columnTypes {
+			values[i+1] = benchmarkColumnTypes[name].value(rng)
+		}
+		if _, err := writer.exec(ctx, values...); err != nil {
+			return 0, fmt.Errorf("error inserting row %d: %v", row, err)
+		}
+		if err := writer.rowDone(); err != nil {
+			return 0, err
+		}
+	}
+	if err := writer.commit(); err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
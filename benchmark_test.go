@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRunBenchmarkOwnTable(t *testing.T) {
+	dst := &fakeDB{}
+	db := openFake(t, dst)
+	opts := migrationOptions{destInitSQL: []string{"SET unique_checks=0"}, destFinalizeSQL: []string{"SET unique_checks=1"}}
+	if err := runBenchmark(context.Background(), db, []string{"int"}, 3, []int{2}, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every table statement must name the table this run created, and -destInitSQL
+	// must run before the inserts
+	var table string
+	initRan := false
+	for _, statement := range dst.statements {
+		switch {
+		case strings.HasPrefix(statement, "CREATE TABLE "):
+			table = strings.Fields(statement)[2]
+			if !strings.HasPrefix(table, benchmarkTablePrefix) {
+				t.Errorf("created table %q, want prefix %q", table, benchmarkTablePrefix)
+			}
+		case strings.HasPrefix(statement, "DROP TABLE"), strings.HasPrefix(statement, "TRUNCATE TABLE"):
+			if table == "" || !strings.HasSuffix(statement, " "+table) {
+				t.Errorf("statement %q does not target the created table %q", statement, table)
+			}
+		case statement == "SET unique_checks=0":
+			initRan = true
+		case strings.HasPrefix(statement, "INSERT"):
+			if !initRan {
+				t.Errorf("insert ran before -destInitSQL")
+			}
+		}
+	}
+	if !dst.ran("DROP TABLE " + table) {
+		t.Errorf("benchmark table %q was not dropped: %q", table, dst.statements)
+	}
+	if !dst.ran("SET unique_checks=1") {
+		t.Errorf("-destFinalizeSQL did not run: %q", dst.statements)
+	}
+}
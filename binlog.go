@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// binlogPosition is the source binary log position and executed GTID set a table
+// snapshot was read at, each when captured
+type binlogPosition struct {
+	Table        string `json:"table"`
+	File         string `json:"file,omitempty"`
+	Position     uint64 `json:"position,omitempty"`
+	GTIDExecuted string `json:"gtidExecuted,omitempty"`
+}
+
+// binlogPositions collects the positions captured by concurrently migrated tables
+type binlogPositions struct {
+	mu        sync.Mutex
+	positions []binlogPosition
+}
+
+func (b *binlogPositions) add(position binlogPosition) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.positions = append(b.positions, position)
+}
+
+// writeFile saves the captured positions as JSON for a CDC tool to pick up from
+func (b *binlogPositions) writeFile(path string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	data, err := json.MarshalIndent(b.positions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// captureBinlogPosition reads the source binary log position inside the snapshot
+// transaction. The snapshot is established by the first read that follows, so writes
+// committed in between may already be part of it; CDC consumers must tolerate replaying them.
+func captureBinlogPosition(ctx context.Context, tx *sql.Tx, table string) (binlogPosition, error) {
+	rows, err := tx.QueryContext(ctx, "SHOW MASTER STATUS")
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == errParse {
+		// MySQL 8.4 removed SHOW MASTER STATUS in favour of SHOW BINARY LOG STATUS
+		rows, err = tx.QueryContext(ctx, "SHOW BINARY LOG STATUS")
+	}
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == errSpecificAccess {
+		return binlogPosition{}, fmt.Errorf("capturing the binlog position requires the REPLICATION CLIENT privilege on the source: %v", err)
+	}
+	if err != nil {
+		return binlogPosition{}, fmt.Errorf("failed to query binlog status: %v", err)
+	}
+	defer rows.Close()
+
+	// The column set differs between server versions, so pick File and Position by name
+	cols, err := rows.Columns()
+	if err != nil {
+		return binlogPosition{}, err
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return binlogPosition{}, err
+		}
+		return binlogPosition{}, fmt.Errorf("binary logging is disabled on the source")
+	}
+	values := make([]sql.NullString, len(cols))
+	valuePointers := make([]interface{}, len(cols))
+	for i := range values {
+		valuePointers[i] = &values[i]
+	}
+	if err := rows.Scan(valuePointers...); err != nil {
+		return binlogPosition{}, fmt.Errorf("failed to scan binlog status: %v", err)
+	}
+
+	position := binlogPosition{Table: table}
+	for i, col := range cols {
+		switch col {
+		case "File":
+			position.File = values[i].String
+		case "Position":
+			position.Position, err = strconv.ParseUint(values[i].String, 10, 64)
+			if err != nil {
+				return binlogPosition{}, fmt.Errorf("invalid binlog position %q: %v", values[i].String, err)
+			}
+		}
+	}
+	return position, nil
+}
+
+// captureGTIDExecuted reads the executed GTID set of the source inside the snapshot
+// transaction, with the same caveat as captureBinlogPosition. Only with gtid_mode ON is
+// every transaction in the set; MariaDB has its own GTID format and no gtid_mode.
+func captureGTIDExecuted(ctx context.Context, tx *sql.Tx) (string, error) {
+	var mode, executed string
+	err := tx.QueryRowContext(ctx, "SELECT @@GLOBAL.gtid_mode, @@GLOBAL.gtid_executed").Scan(&mode, &executed)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == errUnknownSysVar {
+		return "", fmt.Errorf("the source has no gtid_mode, -captureGTID needs MySQL GTIDs (use -captureBinlogPos on MariaDB)")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to query executed GTIDs: %v", err)
+	}
+	if mode != "ON" {
+		return "", fmt.Errorf("gtid_mode is %s on the source, -captureGTID needs it ON", mode)
+	}
+	// Sets spanning several servers are listed one per line
+	return strings.ReplaceAll(executed, "\n", ""), nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// checkConstraint is a CHECK constraint of a table
+type checkConstraint struct {
+	name     string
+	clause   string
+	enforced bool
+}
+
+// MariaDB lists check constraints with their table, MySQL only through table_constraints.
+// MariaDB names column-level constraints after their column, so names are only unique
+// per table there, and the MySQL query would mix up tables.
+const (
+	mariaDBCheckQuery = `SELECT constraint_name, check_clause, 'YES'
+		FROM information_schema.check_constraints
+		WHERE constraint_schema = COALESCE(?, DATABASE()) AND table_name = ?
+		ORDER BY constraint_name`
+	mysqlCheckQuery = `SELECT cc.constraint_name, cc.check_clause, tc.enforced
+		FROM information_schema.table_constraints tc
+		JOIN information_schema.check_constraints cc
+			ON cc.constraint_schema = tc.constraint_schema AND cc.constraint_name = tc.constraint_name
+		WHERE tc.table_schema = COALESCE(?, DATABASE()) AND tc.table_name = ? AND tc.constraint_type = 'CHECK'
+		ORDER BY tc.constraint_name`
+)
+
+// getCheckConstraints returns the CHECK constraints of a table. Servers without
+// information_schema.check_constraints (MySQL before 8.0.16) yield none.
+func getCheckConstraints(db *sql.DB, tableName string) ([]checkConstraint, error) {
+	schema, table := splitTableName(tableName)
+	rows, err := db.Query(mariaDBCheckQuery, schema, table)
+	var mysqlErr *mysql.MySQLError
+	if err != nil && errors.As(err, &mysqlErr) && mysqlErr.Number == errBadFieldError {
+		rows, err = db.Query(mysqlCheckQuery, schema, table)
+	}
+	if err != nil {
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == errUnknownTable {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to query check constraints: %v", err)
+	}
+	defer rows.Close()
+
+	var checks []checkConstraint
+	for rows.Next() {
+		var check checkConstraint
+		var enforced string
+		if err := rows.Scan(&check.name, &check.clause, &enforced); err != nil {
+			return nil, fmt.Errorf("failed to scan check constraint: %v", err)
+		}
+		check.enforced = enforced == "YES"
+		checks = append(checks, check)
+	}
+	return checks, rows.Err()
+}
+
+// enforcesChecks reports whether a server enforces CHECK constraints instead of
+// parsing and ignoring them: MySQL from 8.0.16, MariaDB from 10.2
+func enforcesChecks(server serverInfo) bool {
+	if server.mariaDB {
+		return server.atLeast(10, 2)
+	}
+	if server.major != 8 || server.minor != 0 {
+		return server.atLeast(8, 0)
+	}
+	parts := strings.SplitN(server.version, ".", 3)
+	if len(parts) < 3 {
+		return false
+	}
+	patch := parts[2]
+	if end := strings.IndexFunc(patch, func(r rune) bool { return r < '0' || r > '9' }); end >= 0 {
+		patch = patch[:end]
+	}
+	n, _ := strconv.Atoi(patch)
+	return n >= 16
+}
+
+// checkDefinitions renders the CHECK constraints of sourceTable as CREATE TABLE clauses.
+// MySQL names unnamed constraints <table>_chk_<n>; those names are left out so the
+// destination picks its own, since constraint names must be unique per database.
+// MariaDB has no NOT ENFORCED, so unenforced constraints are left out there.
+func checkDefinitions(checks []checkConstraint, sourceTable string, destServer serverInfo) []string {
+	if len(checks) > 0 && !enforcesChecks(destServer) {
+		log.Printf("Warning: %s parses but does not enforce the CHECK constraints of '%s'\n", destServer, sourceTable)
+	}
+	var definitions []string
+	for _, check := range checks {
+		if !check.enforced && destServer.mariaDB {
+			log.Printf("Warning: skipping NOT ENFORCED check constraint '%s' of '%s', MariaDB would enforce it\n", check.name, sourceTable)
+			continue
+		}
+		definition := fmt.Sprintf("CHECK (%s)", check.clause)
+		if !generatedCheckName(check.name, sourceTable) {
+			definition = fmt.Sprintf("CONSTRAINT `%s` %s", check.name, definition)
+		}
+		if !check.enforced {
+			definition += " NOT ENFORCED"
+		}
+		definitions = append(definitions, definition)
+	}
+	return definitions
+}
+
+// generatedCheckName reports whether name is one MySQL made up for an unnamed CHECK
+// constraint of table, <table>_chk_<n>
+func generatedCheckName(name, tableName string) bool {
+	_, table := splitTableName(tableName)
+	suffix, ok := strings.CutPrefix(name, table+"_chk_")
+	if !ok || suffix == "" {
+		return false
+	}
+	_, err := strconv.ParseUint(suffix, 10, 64)
+	return err == nil
+}
+
+// addMissingChecks adds the source CHECK constraints the existing destination table
+// lacks. Named constraints are matched by name, unnamed ones by their clause since the
+// destination numbers them after its own table.
+func addMissingChecks(srcDB, destDB *sql.DB, sourceTable, destTable string) error {
+	srcChecks, err := getCheckConstraints(srcDB, sourceTable)
+	if err != nil {
+		return err
+	}
+	destChecks, err := getCheckConstraints(destDB, destTable)
+	if err != nil {
+		return err
+	}
+	names := make(map[string]bool, len(destChecks))
+	clauses := make(map[string]bool, len(destChecks))
+	for _, check := range destChecks {
+		names[check.name] = true
+		clauses[check.clause] = true
+	}
+
+	var missing []checkConstraint
+	for _, check := range srcChecks {
+		present := names[check.name]
+		if generatedCheckName(check.name, sourceTable) {
+			present = clauses[check.clause]
+		}
+		if present {
+			progressf("Check constraint '%s' already exists on '%s', skipping\n", check.name, destTable)
+			continue
+		}
+		missing = append(missing, check)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	destServer, err := detectServer(destDB)
+	if err != nil {
+		return err
+	}
+	for _, definition := range checkDefinitions(missing, sourceTable, destServer) {
+		statement := fmt.Sprintf("ALTER TABLE %s ADD %s", destTable, definition)
+		if _, err := destDB.Exec(statement); err != nil {
+			return fmt.Errorf("failed to add check constraint: %v\ngenerated statement: %s", err, statement)
+		}
+		progressf("Check constraint added to existing table '%s': %s\n", destTable, definition)
+	}
+	return nil
+}
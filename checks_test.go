@@ -0,0 +1,148 @@
+package main
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestEnforcesChecks(t *testing.T) {
+	tests := []struct {
+		server serverInfo
+		want   bool
+	}{
+		{serverInfo{version: "5.7.44", major: 5, minor: 7}, false},
+		{serverInfo{version: "8.0.15", major: 8, minor: 0}, false},
+		{serverInfo{version: "8.0.16", major: 8, minor: 0}, true},
+		{serverInfo{version: "8.0.36-log", major: 8, minor: 0}, true},
+		{serverInfo{version: "8.4.0", major: 8, minor: 4}, true},
+		{serverInfo{version: "10.1.48-MariaDB", mariaDB: true, major: 10, minor: 1}, false},
+		{serverInfo{version: "10.2.44-MariaDB", mariaDB: true, major: 10, minor: 2}, true},
+	}
+	for _, tt := range tests {
+		if got := enforcesChecks(tt.server); got != tt.want {
+			t.Errorf("enforcesChecks(%s) = %v, want %v", tt.server, got, tt.want)
+		}
+	}
+}
+
+func TestCheckDefinitions(t *testing.T) {
+	checks := []checkConstraint{
+		{name: "forms_chk_1", clause: "(`status` in (0,1))", enforced: true},
+		{name: "positive_count", clause: "(`count` >= 0)", enforced: true},
+		{name: "forms_chk_2", clause: "(`size` < 100)", enforced: false},
+		// Only the generated <table>_chk_<n> names are left out
+		{name: "forms_chk_limit", clause: "(`limit` > 0)", enforced: true},
+		{name: "users_chk_1", clause: "(`age` > 0)", enforced: true},
+	}
+	tests := []struct {
+		table  string
+		server serverInfo
+		want   []string
+	}{
+		{"forms", serverInfo{version: "8.0.36", major: 8, minor: 0}, []string{
+			"CHECK ((`status` in (0,1)))",
+			"CONSTRAINT `positive_count` CHECK ((`count` >= 0))",
+			"CHECK ((`size` < 100)) NOT ENFORCED",
+			"CONSTRAINT `forms_chk_limit` CHECK ((`limit` > 0))",
+			"CONSTRAINT `users_chk_1` CHECK ((`age` > 0))",
+		}},
+		// A qualified table name is matched by its table part
+		{"app.forms", serverInfo{version: "10.11.6-MariaDB", mariaDB: true, major: 10, minor: 11}, []string{
+			"CHECK ((`status` in (0,1)))",
+			"CONSTRAINT `positive_count` CHECK ((`count` >= 0))",
+			"CONSTRAINT `forms_chk_limit` CHECK ((`limit` > 0))",
+			"CONSTRAINT `users_chk_1` CHECK ((`age` > 0))",
+		}},
+	}
+	for _, tt := range tests {
+		if got := checkDefinitions(checks, tt.table, tt.server); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("checkDefinitions(%s, %s) = %q, want %q", tt.table, tt.server, got, tt.want)
+		}
+	}
+}
+
+func TestGeneratedCheckName(t *testing.T) {
+	tests := []struct {
+		name  string
+		table string
+		want  bool
+	}{
+		{"forms_chk_1", "forms", true},
+		{"forms_chk_12", "app.forms", true},
+		{"forms_chk_", "forms", false},
+		{"forms_chk_limit", "forms", false},
+		{"users_chk_1", "forms", false},
+		{"positive_count", "forms", false},
+	}
+	for _, tt := range tests {
+		if got := generatedCheckName(tt.name, tt.table); got != tt.want {
+			t.Errorf("generatedCheckName(%q, %q) = %v, want %v", tt.name, tt.table, got, tt.want)
+		}
+	}
+}
+
+func TestAddMissingChecksTwice(t *testing.T) {
+	srcChecks := [][]driver.Value{
+		{"forms_chk_1", "(`status` in (0,1))", "YES"},
+		{"positive_count", "(`count` >= 0)", "YES"},
+		{"forms_chk_2", "(`size` < 100)", "YES"},
+	}
+	checkRows := func(rows [][]driver.Value) *fakeRows {
+		return &fakeRows{cols: []string{"constraint_name", "check_clause", "enforced"}, rows: rows}
+	}
+	src := openFake(t, &fakeDB{query: func(string, []driver.Value) *fakeRows { return checkRows(srcChecks) }})
+
+	// The destination, a copy named forms_copy, kept its first unnamed check and gains
+	// every check it is altered with
+	var mu sync.Mutex
+	destChecks := [][]driver.Value{{"forms_copy_chk_1", "(`status` in (0,1))", "YES"}}
+	dest := &fakeDB{
+		query: func(query string, _ []driver.Value) *fakeRows {
+			if strings.Contains(query, "VERSION()") {
+				return &fakeRows{cols: []string{"version"}, rows: [][]driver.Value{{"8.0.36"}}}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			return checkRows(append([][]driver.Value(nil), destChecks...))
+		},
+		exec: func(query string, _ []driver.Value) error {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, row := range srcChecks {
+				if strings.Contains(query, row[1].(string)) {
+					name := row[0].(string)
+					if generatedCheckName(name, "forms") {
+						name = fmt.Sprintf("forms_copy_chk_%d", len(destChecks)+1)
+					}
+					destChecks = append(destChecks, []driver.Value{name, row[1], row[2]})
+				}
+			}
+			return nil
+		},
+	}
+	destDB := openFake(t, dest)
+
+	for run := 1; run <= 2; run++ {
+		if err := addMissingChecks(src, destDB, "forms", "forms_copy"); err != nil {
+			t.Fatalf("run %d: addMissingChecks() error = %v", run, err)
+		}
+	}
+
+	var alters []string
+	for _, statement := range dest.statements {
+		if strings.HasPrefix(statement, "ALTER TABLE") {
+			alters = append(alters, statement)
+		}
+	}
+	want := []string{
+		"ALTER TABLE forms_copy ADD CONSTRAINT `positive_count` CHECK ((`count` >= 0))",
+		"ALTER TABLE forms_copy ADD CHECK ((`size` < 100))",
+	}
+	if !reflect.DeepEqual(alters, want) {
+		t.Errorf("two runs altered the table with %q, want %q once", alters, want)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Chunked reads select the source in chunks of chunkSize rows, each in its own short
+// read-only transaction, so locks and snapshots are released between chunks and
+// pause gives the source room to breathe. Tables are read in primary key order,
+// continuing after the last key of the previous chunk, which costs the same for every
+// chunk. Without a key there is no stable order to continue from, so tables without
+// one cannot be chunked. The chunks are not one consistent snapshot: rows changed
+// during the copy may be copied in their old or new state.
+
+// chunkedRows reads the rows of from in chunks, ordered by keyColumns. beforeQuery
+// runs in the transaction of the first chunk only.
+func chunkedRows(ctx context.Context, srcDB *sql.DB, from, condition string, keyColumns []string, isolation sql.IsolationLevel, beforeQuery func(*sql.Tx) error, chunkSize int, pause time.Duration) (*sourceRows, error) {
+	if len(keyColumns) == 0 {
+		return nil, fmt.Errorf("-chunkSize needs a primary key to order the chunks of '%s'", from)
+	}
+	quotedKeys := make([]string, len(keyColumns))
+	for i, key := range keyColumns {
+		quotedKeys[i] = fmt.Sprintf("`%s`", key)
+	}
+
+	var (
+		tx         *sql.Tx
+		rows       *sql.Rows
+		keyIndexes []int
+		keyMarks   string
+		lastKey    []interface{}
+		chunk      int
+		chunkRows  int
+	)
+	openChunk := func() error {
+		chunkCondition := condition
+		var args []interface{}
+		if lastKey != nil {
+			chunkCondition = joinConditions(condition, fmt.Sprintf("(%s) > (%s)", strings.Join(quotedKeys, ", "), keyMarks))
+			args = lastKey
+		}
+
+		query := fmt.Sprintf("SELECT * FROM %s%s ORDER BY %s LIMIT %d", from, whereClause(chunkCondition), strings.Join(quotedKeys, ", "), chunkSize)
+		var err error
+		tx, rows, err = querySource(ctx, srcDB, query, args, isolation, beforeQuery)
+		if err != nil {
+			return fmt.Errorf("error fetching chunk %d from source table: %v", chunk+1, err)
+		}
+		beforeQuery = nil
+		chunk++
+		chunkRows = 0
+		return nil
+	}
+	closeChunk := func() {
+		if rows != nil {
+			rows.Close()
+			tx.Rollback()
+			rows, tx = nil, nil
+		}
+	}
+
+	if err := openChunk(); err != nil {
+		return nil, err
+	}
+	source := &sourceRows{close: closeChunk, finish: func() error { return nil }}
+	var err error
+	source.cols, err = rows.Columns()
+	if err != nil {
+		closeChunk()
+		return nil, fmt.Errorf("error fetching column information: %v", err)
+	}
+	source.typeNames, err = columnTypeNames(rows)
+	if err != nil {
+		closeChunk()
+		return nil, fmt.Errorf("error fetching column types: %v", err)
+	}
+	keyIndexes = columnIndexes(source.cols, keyColumns)
+	if len(keyIndexes) != len(keyColumns) {
+		closeChunk()
+		return nil, fmt.Errorf("primary key columns %v of '%s' are not all selected", keyColumns, from)
+	}
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		closeChunk()
+		return nil, fmt.Errorf("error fetching column types: %v", err)
+	}
+	marks := make([]string, len(keyIndexes))
+	for i, index := range keyIndexes {
+		marks[i] = keysetMark(columnTypes[index])
+	}
+	keyMarks = strings.Join(marks, ", ")
+
+	scanner := newRowScanner(source.typeNames)
+	source.next = func() ([]interface{}, error) {
+		for {
+			if rows == nil {
+				return nil, io.EOF
+			}
+			if rows.Next() {
+				values, err := scanner.scan(rows)
+				if err != nil {
+					return nil, fmt.Errorf("error scanning row: %v", err)
+				}
+				chunkRows++
+				// The values are reused by the next scan, so the key is copied out
+				if lastKey == nil {
+					lastKey = make([]interface{}, len(keyIndexes))
+				}
+				for i, index := range keyIndexes {
+					lastKey[i], err = keysetValue(source.typeNames[index], values[index])
+					if err != nil {
+						return nil, fmt.Errorf("error reading key column '%s': %v", source.cols[index], err)
+					}
+				}
+				return values, nil
+			}
+			if err := rows.Err(); err != nil {
+				return nil, fmt.Errorf("error iterating over rows: %v", err)
+			}
+			rows.Close()
+			if err := tx.Commit(); err != nil {
+				return nil, fmt.Errorf("error committing source transaction: %v", err)
+			}
+			rows, tx = nil, nil
+			progressf("Read chunk %d of '%s': %d rows\n", chunk, from, chunkRows)
+
+			// A short chunk is the last one
+			if chunkRows < chunkSize {
+				return nil, io.EOF
+			}
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(pause):
+			}
+			if err := openChunk(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return source, nil
+}
+
+// keysetValue converts a key value read as text back to the integer it is. MySQL
+// compares an integer column with a string as DOUBLE, which cannot tell keys above
+// 2^53 apart, so the next chunk could repeat or skip rows.
+func keysetValue(typeName string, value interface{}) (interface{}, error) {
+	text, ok := value.(string)
+	if !ok {
+		return value, nil
+	}
+	switch typeName {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "YEAR":
+		return strconv.ParseInt(text, 10, 64)
+	// Unsigned values above math.MaxInt64 only fit in a uint64
+	case "UNSIGNED TINYINT", "UNSIGNED SMALLINT", "UNSIGNED MEDIUMINT", "UNSIGNED INT", "UNSIGNED BIGINT":
+		return strconv.ParseUint(text, 10, 64)
+	}
+	return value, nil
+}
+
+// keysetMark is the placeholder for a key value of the column. A DECIMAL key stays
+// text, so it is cast to the column's own type to be compared exactly.
+func keysetMark(columnType *sql.ColumnType) string {
+	if columnType.DatabaseTypeName() == "DECIMAL" {
+		if precision, scale, ok := columnType.DecimalSize(); ok {
+			return fmt.Sprintf("CAST(? AS DECIMAL(%d,%d))", precision, scale)
+		}
+	}
+	return "?"
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestKeysetValue(t *testing.T) {
+	tests := []struct {
+		typeName string
+		value    interface{}
+		want     interface{}
+	}{
+		{"INT", "42", int64(42)},
+		{"BIGINT", "-9007199254740993", int64(-9007199254740993)},
+		{"UNSIGNED BIGINT", "18446744073709551615", uint64(18446744073709551615)},
+		{"VARCHAR", "42", "42"},
+		{"DECIMAL", "9007199254740993.5", "9007199254740993.5"},
+		{"BIGINT", int64(7), int64(7)},
+	}
+	for _, tt := range tests {
+		got, err := keysetValue(tt.typeName, tt.value)
+		if err != nil || got != tt.want {
+			t.Errorf("keysetValue(%q, %#v) = %#v, %v, want %#v", tt.typeName, tt.value, got, err, tt.want)
+		}
+	}
+	if _, err := keysetValue("BIGINT", "1e3"); err == nil {
+		t.Errorf("keysetValue(%q, %q) error = nil, want an error", "BIGINT", "1e3")
+	}
+}
+
+func TestChunkedRowsLargeKey(t *testing.T) {
+	// 2^53+1 reads as 2^53 when compared as DOUBLE
+	const key = uint64(9007199254740993)
+	var mu sync.Mutex
+	var chunkArgs [][]driver.Value
+	src := openFake(t, &fakeDB{query: func(query string, args []driver.Value) *fakeRows {
+		mu.Lock()
+		chunkArgs = append(chunkArgs, args)
+		mu.Unlock()
+		rows := &fakeRows{cols: []string{"id", "name"}, typeNames: []string{"UNSIGNED BIGINT"}}
+		if len(args) == 0 {
+			// The text protocol hands integers over as text
+			rows.rows = [][]driver.Value{{[]byte("9007199254740993"), []byte("a")}}
+		}
+		return rows
+	}})
+
+	source, err := chunkedRows(context.Background(), src, "forms", "", []string{"id"}, sql.LevelDefault, nil, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.close()
+	for {
+		if _, err := source.next(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// database/sql binds a uint64 that fits as int64
+	if len(chunkArgs) != 2 || !reflect.DeepEqual(chunkArgs[1], []driver.Value{int64(key)}) {
+		t.Errorf("chunk query args = %#v, want the second chunk to continue after %d as a number", chunkArgs, key)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+)
+
+// numericKeyTypes are the column types whose keys are ordered and compared as numbers
+var numericKeyTypes = map[string]bool{
+	"TINYINT": true, "SMALLINT": true, "MEDIUMINT": true, "INT": true, "BIGINT": true,
+	"UNSIGNED TINYINT": true, "UNSIGNED SMALLINT": true, "UNSIGNED MEDIUMINT": true,
+	"UNSIGNED INT": true, "UNSIGNED BIGINT": true, "DECIMAL": true, "YEAR": true,
+}
+
+// tableDiff counts the differences found by compareTable
+type tableDiff struct {
+	onlyInSource int
+	onlyInDest   int
+	changed      int
+}
+
+func (d tableDiff) total() int {
+	return d.onlyInSource + d.onlyInDest + d.changed
+}
+
+// compareTable streams both tables ordered by the source primary key and merge-joins
+// them, writing one line per row that is missing on either side or has differing values
+func compareTable(ctx context.Context, srcDB, dstDB *sql.DB, table tablePair, out io.Writer) (tableDiff, error) {
+	var diff tableDiff
+
+	keyColumns, err := getPrimaryKeyColumns(srcDB, table.source)
+	if err != nil {
+		return diff, fmt.Errorf("error fetching primary key: %v", err)
+	}
+	if len(keyColumns) == 0 {
+		return diff, fmt.Errorf("table '%s' has no primary key to compare by", table.source)
+	}
+	columnTypes, err := getColumnTypes(srcDB, table.source)
+	if err != nil {
+		return diff, fmt.Errorf("error fetching column types: %v", err)
+	}
+
+	// Select the source columns from both sides so values line up by position
+	srcColumns, err := getColumns(srcDB, table.source)
+	if err != nil {
+		return diff, err
+	}
+	cols := make([]string, len(srcColumns))
+	for i, column := range srcColumns {
+		cols[i] = column.name
+	}
+
+	// Non-numeric keys are ordered by their bytes so the database order matches Go's
+	quotedCols := make([]string, len(cols))
+	for i, col := range cols {
+		quotedCols[i] = fmt.Sprintf("`%s`", col)
+	}
+	orderBy := make([]string, len(keyColumns))
+	for i, key := range keyColumns {
+		if numericKeyTypes[columnTypes[key].DatabaseTypeName()] {
+			orderBy[i] = fmt.Sprintf("`%s`", key)
+		} else {
+			orderBy[i] = fmt.Sprintf("BINARY `%s`", key)
+		}
+	}
+	selectColumns := strings.Join(quotedCols, ", ")
+	order := strings.Join(orderBy, ", ")
+
+	srcRows, err := srcDB.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM %s ORDER BY %s", selectColumns, table.source, order))
+	if err != nil {
+		return diff, fmt.Errorf("error reading source table: %v", err)
+	}
+	defer srcRows.Close()
+	dstRows, err := dstDB.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM %s ORDER BY %s", selectColumns, table.dest, order))
+	if err != nil {
+		return diff, fmt.Errorf("error reading destination table: %v", err)
+	}
+	defer dstRows.Close()
+
+	typeNames, err := columnTypeNames(srcRows)
+	if err != nil {
+		return diff, err
+	}
+	keyIndexes := columnIndexes(cols, keyColumns)
+
+	// next advances a cursor, returning nil values once it is exhausted
+	next := func(rows *sql.Rows) ([]interface{}, error) {
+		if !rows.Next() {
+			return nil, rows.Err()
+		}
+		return scanRow(rows, typeNames)
+	}
+
+	srcValues, err := next(srcRows)
+	if err != nil {
+		return diff, err
+	}
+	dstValues, err := next(dstRows)
+	if err != nil {
+		return diff, err
+	}
+
+	for srcValues != nil || dstValues != nil {
+		cmp := 0
+		switch {
+		case srcValues == nil:
+			cmp = 1
+		case dstValues == nil:
+			cmp = -1
+		default:
+			cmp = compareKeys(srcValues, dstValues, keyIndexes, typeNames)
+		}
+
+		switch {
+		case cmp < 0:
+			fmt.Fprintf(out, "only in source: %s\n", describeKey(cols, srcValues, keyIndexes))
+			diff.onlyInSource++
+			srcValues, err = next(srcRows)
+		case cmp > 0:
+			fmt.Fprintf(out, "only in destination: %s\n", describeKey(cols, dstValues, keyIndexes))
+			diff.onlyInDest++
+			dstValues, err = next(dstRows)
+		default:
+			var changed []string
+			for i, col := range cols {
+				if !valuesEqual(srcValues[i], dstValues[i]) {
+					changed = append(changed, col)
+				}
+			}
+			if len(changed) > 0 {
+				fmt.Fprintf(out, "differs: %s columns: %s\n", describeKey(cols, srcValues, keyIndexes), strings.Join(changed, ", "))
+				diff.changed++
+			}
+			srcValues, err = next(srcRows)
+			if err == nil {
+				dstValues, err = next(dstRows)
+			}
+		}
+		if err != nil {
+			return diff, fmt.Errorf("error reading rows: %v", err)
+		}
+	}
+
+	return diff, nil
+}
+
+// compareKeys orders two rows by their key columns, numerically for numeric keys and
+// bytewise otherwise, matching the ORDER BY used by compareTable
+func compareKeys(a, b []interface{}, keyIndexes []int, typeNames []string) int {
+	for _, index := range keyIndexes {
+		x, y := fmt.Sprint(a[index]), fmt.Sprint(b[index])
+		if numericKeyTypes[typeNames[index]] {
+			xr, xok := new(big.Rat).SetString(x)
+			yr, yok := new(big.Rat).SetString(y)
+			if xok && yok {
+				if cmp := xr.Cmp(yr); cmp != 0 {
+					return cmp
+				}
+				continue
+			}
+		}
+		if cmp := strings.Compare(x, y); cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+// valuesEqual reports whether two scanned column values are the same, treating NULL
+// as equal only to NULL
+func valuesEqual(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+// compareTables compares every table pair and writes the differences to out.
+// It reports whether all tables matched.
+func compareTables(ctx context.Context, srcDB, dstDB *sql.DB, tables []tablePair, out io.Writer) (bool, error) {
+	identical := true
+	for _, table := range tables {
+		diff, err := compareTable(ctx, srcDB, dstDB, table, out)
+		if err != nil {
+			return false, fmt.Errorf("table '%s': %v", table.source, err)
+		}
+		fmt.Printf("Compared '%s' to '%s': %d only in source, %d only in destination, %d differing\n",
+			table.source, table.dest, diff.onlyInSource, diff.onlyInDest, diff.changed)
+		if diff.total() > 0 {
+			identical = false
+		}
+	}
+	return identical, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// MySQL server error numbers
+const (
+	errDiskFull       = 1021
+	errGetErrno       = 1030
+	errDBAccessDenied = 1044
+	errAccessDenied   = 1045
+	errUnknownDB      = 1049
+	errBadFieldError  = 1054
+	errParse          = 1064
+	errUnknownTable   = 1109
+	errRecordFileFull = 1114
+	errUnknownSysVar  = 1193
+	errSpecificAccess = 1227
+)
+
+// buildDSN builds a go-sql-driver DSN. The driver runs SET for every parameter that is
+// not one of its own options on each new connection, so params can carry session variables.
+func buildDSN(user, password, host, dbName string, params url.Values) string {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s", user, password, host, dbName)
+	if len(params) > 0 {
+		dsn += "?" + params.Encode()
+	}
+	return dsn
+}
+
+// setConnCharset sets the charset and collation of the connections in params, leaving
+// out the empty ones. They are driver options rather than session variables: the driver
+// negotiates the collation at connect and runs SET NAMES for the charset.
+func setConnCharset(params url.Values, charset, collation string) error {
+	if collation != "" && charset != "" && !strings.HasPrefix(collation, charset+"_") {
+		return fmt.Errorf("collation '%s' does not belong to character set '%s'", collation, charset)
+	}
+	if charset != "" {
+		params.Set("charset", charset)
+	}
+	if collation != "" {
+		params.Set("collation", collation)
+	}
+	return nil
+}
+
+// setPreserveIds adds NO_AUTO_VALUE_ON_ZERO to the session sql_mode in params. Inserted
+// ids are always explicit, but without it MySQL still renumbers an id of 0.
+func setPreserveIds(params url.Values) {
+	params.Set("sql_mode", "CONCAT(@@sql_mode, ',NO_AUTO_VALUE_ON_ZERO')")
+}
+
+// quoteSessionValue quotes a string for use as a session variable value in a DSN
+func quoteSessionValue(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// pingWithRetry pings the database, retrying up to retries more times while the
+// server is unreachable or still starting up
+func pingWithRetry(db *sql.DB, name string, retries int, interval time.Duration) error {
+	for attempt := 1; ; attempt++ {
+		err := db.Ping()
+		if err == nil {
+			return nil
+		}
+		if !isRetryableConnectError(err) || attempt > retries {
+			return err
+		}
+		log.Printf("Connecting to %s database failed (attempt %d of %d): %v, retrying in %s\n", name, attempt, retries+1, err, interval)
+		time.Sleep(interval)
+	}
+}
+
+// isRetryableConnectError reports whether a connection error may go away on its own,
+// as opposed to credential or database name errors
+func isRetryableConnectError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case errDBAccessDenied, errAccessDenied, errUnknownDB:
+			return false
+		}
+	}
+	return !isDiskFullError(err)
+}
+
+// isDiskFullError reports whether the server ran out of disk space or the table or
+// tablespace reached its size limit. Retrying cannot help until space is freed.
+func isDiskFullError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return false
+	}
+	switch mysqlErr.Number {
+	case errDiskFull, errRecordFileFull:
+		return true
+	case errGetErrno:
+		// "Got error 28 from storage engine", 28 being ENOSPC
+		return strings.Contains(mysqlErr.Message, "error 28 ")
+	}
+	return strings.Contains(mysqlErr.Message, "No space left on device")
+}
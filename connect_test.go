@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestBuildDSN(t *testing.T) {
+	tests := []struct {
+		params url.Values
+		want   string
+	}{
+		{nil, "user:secret@tcp(db:3306)/app"},
+		{url.Values{"time_zone": {quoteSessionValue("+00:00")}}, "user:secret@tcp(db:3306)/app?time_zone=%27%2B00%3A00%27"},
+	}
+	for _, tt := range tests {
+		if got := buildDSN("user", "secret", "db:3306", "app", tt.params); got != tt.want {
+			t.Errorf("buildDSN(%v) = %q, want %q", tt.params, got, tt.want)
+		}
+	}
+
+	// The driver hands the session variable back quoted, ready for SET
+	config, err := mysql.ParseDSN(buildDSN("user", "secret", "db:3306", "app", url.Values{"time_zone": {quoteSessionValue("+00:00")}}))
+	if err != nil {
+		t.Fatalf("ParseDSN() error = %v", err)
+	}
+	if got := config.Params["time_zone"]; got != "'+00:00'" {
+		t.Errorf("time_zone parameter = %q, want %q", got, "'+00:00'")
+	}
+}
+
+func TestQuoteSessionValue(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"+00:00", "'+00:00'"},
+		{"Europe/Istanbul", "'Europe/Istanbul'"},
+		{"it's", "'it''s'"},
+	}
+	for _, tt := range tests {
+		if got := quoteSessionValue(tt.value); got != tt.want {
+			t.Errorf("quoteSessionValue(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestSetConnCharset(t *testing.T) {
+	tests := []struct {
+		charset   string
+		collation string
+		want      url.Values
+		wantErr   bool
+	}{
+		{"utf8mb4", "", url.Values{"charset": {"utf8mb4"}}, false},
+		{"utf8mb4", "utf8mb4_unicode_ci", url.Values{"charset": {"utf8mb4"}, "collation": {"utf8mb4_unicode_ci"}}, false},
+		{"", "latin1_swedish_ci", url.Values{"collation": {"latin1_swedish_ci"}}, false},
+		{"", "", url.Values{}, false},
+		{"utf8mb4", "latin1_swedish_ci", nil, true},
+		// utf8mb4 collations do not belong to utf8
+		{"utf8", "utf8mb4_general_ci", nil, true},
+	}
+	for _, tt := range tests {
+		params := url.Values{}
+		err := setConnCharset(params, tt.charset, tt.collation)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("setConnCharset(%q, %q) error = %v, want error %v", tt.charset, tt.collation, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(params, tt.want) {
+			t.Errorf("setConnCharset(%q, %q) set %v, want %v", tt.charset, tt.collation, params, tt.want)
+		}
+	}
+}
+
+func TestSetPreserveIds(t *testing.T) {
+	params := url.Values{}
+	setPreserveIds(params)
+
+	// The driver runs SET sql_mode=<value> on each new connection, which keeps the
+	// server's own modes and adds NO_AUTO_VALUE_ON_ZERO
+	config, err := mysql.ParseDSN(buildDSN("user", "secret", "db:3306", "app", params))
+	if err != nil {
+		t.Fatalf("ParseDSN() error = %v", err)
+	}
+	if got, want := config.Params["sql_mode"], "CONCAT(@@sql_mode, ',NO_AUTO_VALUE_ON_ZERO')"; got != want {
+		t.Errorf("sql_mode parameter = %q, want %q", got, want)
+	}
+}
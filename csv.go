@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// exportCSV writes the rows of the source table matching condition, or all of them, to
+// a CSV file with a header row of column names. NULL values are written as nullValue
+// and binary values base64-encoded.
+func exportCSV(ctx context.Context, srcDB *sql.DB, sourceTable, condition, path, compress, nullValue string, isolation sql.IsolationLevel) error {
+	progressf("Exporting '%s' to '%s'\n", sourceTable, path)
+	if condition != "" {
+		progressf("Exporting only rows matching: %s\n", condition)
+	}
+
+	tx, rows, err := querySourceTable(ctx, srcDB, sourceTable, condition, isolation, nil)
+	if err != nil {
+		return fmt.Errorf("error fetching data from source table: %v", err)
+	}
+	defer tx.Rollback()
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("error fetching column information: %v", err)
+	}
+	typeNames, err := columnTypeNames(rows)
+	if err != nil {
+		return fmt.Errorf("error fetching column types: %v", err)
+	}
+
+	out, err := openExportOutput(path, compress)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	writer := csv.NewWriter(out)
+	if err := writer.Write(cols); err != nil {
+		return fmt.Errorf("failed to write CSV header: %v", err)
+	}
+
+	rowCount := 0
+	record := make([]string, len(cols))
+	for rows.Next() {
+		values, err := scanRow(rows, typeNames)
+		if err != nil {
+			return fmt.Errorf("error scanning row: %v", err)
+		}
+		if err := compactJSONValues(values, cols, typeNames); err != nil {
+			return fmt.Errorf("row %d: %v", rowCount+1, err)
+		}
+
+		for i, val := range values {
+			record[i] = formatCSVValue(val, typeNames[i], nullValue)
+		}
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("failed to write row %d: %v", rowCount+1, err)
+		}
+		rowCount++
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over rows: %v", err)
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write CSV: %v", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to close output: %v", err)
+	}
+
+	progressf("Export completed successfully. Total rows exported: %d\n", rowCount)
+	return nil
+}
+
+// exportOutput is the destination of an export, a file or stdout, optionally gzipped.
+// Close finishes the gzip stream before closing the file and may be called again.
+type exportOutput struct {
+	io.Writer
+	gzip   *gzip.Writer
+	file   *os.File
+	closed bool
+}
+
+// openExportOutput creates the export file, or writes to stdout for "-", compressed
+// with gzip when compress is "gzip"
+func openExportOutput(path, compress string) (*exportOutput, error) {
+	out := &exportOutput{Writer: os.Stdout}
+	if path != "-" {
+		file, err := os.Create(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create output file: %v", err)
+		}
+		out.file = file
+		out.Writer = file
+	}
+	if compress == "gzip" {
+		out.gzip = gzip.NewWriter(out.Writer)
+		out.Writer = out.gzip
+	}
+	return out, nil
+}
+
+func (o *exportOutput) Close() error {
+	if o.closed {
+		return nil
+	}
+	o.closed = true
+	var err error
+	if o.gzip != nil {
+		err = o.gzip.Close()
+	}
+	if o.file != nil {
+		if closeErr := o.file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// binaryCSVTypes are the column types whose values are base64-encoded in CSV files, as
+// rowJSON does for binary values, since their bytes need not be valid text
+var binaryCSVTypes = map[string]bool{
+	"BINARY": true, "VARBINARY": true, "TINYBLOB": true, "BLOB": true, "MEDIUMBLOB": true,
+	"LONGBLOB": true, "GEOMETRY": true, "BIT": true,
+}
+
+// formatCSVValue renders a scanned value of a column of the given type as a CSV field
+func formatCSVValue(val interface{}, typeName, nullValue string) string {
+	switch v := val.(type) {
+	case nil:
+		return nullValue
+	case string:
+		if binaryCSVTypes[typeName] {
+			return base64.StdEncoding.EncodeToString([]byte(v))
+		}
+		return v
+	case []byte:
+		if binaryCSVTypes[typeName] {
+			return base64.StdEncoding.EncodeToString(v)
+		}
+		return string(v)
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05.999999")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// importCSV inserts the rows of a CSV file with a header row into the destination table.
+// Header names are matched to destination columns by name, and fields equal to nullValue
+// are inserted as NULL for nullable columns. Binary columns are base64-decoded, as
+// exportCSV writes them. Rows go through a destWriter like a copy from the source, so
+// -onConflict, -rowsPerTransaction, -setColumn, -encryptColumns, -deadLetterTable and
+// the -destInitSQL session apply alike.
+func importCSV(ctx context.Context, dstDB *sql.DB, destTable, path, nullValue string, opts migrationOptions) error {
+	progressf("Importing '%s' into '%s'\n", path, destTable)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open input file: %v", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read CSV header: %v", err)
+	}
+
+	// Look up the destination column types for the CSV columns
+	columnTypes, err := getColumnTypes(dstDB, destTable)
+	if err != nil {
+		return fmt.Errorf("failed to get destination column types: %v", err)
+	}
+	types := make([]*sql.ColumnType, len(header))
+	quotedCols := make([]string, len(header))
+	params := make([]string, len(header))
+	for i, name := range header {
+		types[i] = columnTypes[name]
+		if types[i] == nil {
+			return fmt.Errorf("CSV column '%s' does not exist in destination table '%s'", name, destTable)
+		}
+		quotedCols[i] = fmt.Sprintf("`%s`", name)
+		params[i] = placeholder(dialectMySQL, i+1)
+	}
+	for _, constant := range opts.setColumns {
+		if len(columnIndexes(header, []string{constant.column})) > 0 {
+			return fmt.Errorf("-setColumn column '%s' is also a CSV column", constant.column)
+		}
+	}
+
+	var encryptIndexes []int
+	if opts.encryptor != nil {
+		destColumns, err := getColumns(dstDB, destTable)
+		if err != nil {
+			return fmt.Errorf("error fetching destination columns: %v", err)
+		}
+		encryptIndexes, err = encryptedColumnIndexes(header, opts.encryptColumns, destColumns)
+		if err != nil {
+			return err
+		}
+	}
+
+	insertStmt, constants, err := insertStatement(dstDB, destTable, quotedCols, params, len(header), opts)
+	if err != nil {
+		return err
+	}
+	writer, err := openDestWriter(ctx, dstDB, insertStmt, opts)
+	if err != nil {
+		return err
+	}
+	defer writer.close()
+	var dead *deadLetters
+	if opts.deadLetterTable != "" {
+		dead, err = openDeadLetters(ctx, dstDB, opts.deadLetterTable, path, destTable)
+		if err != nil {
+			return err
+		}
+	}
+
+	rowCount := 0
+	failedCount := 0
+	lineNumber := 1
+	args := make([]interface{}, 0, len(header)+len(constants))
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		lineNumber++
+		if err != nil {
+			return fmt.Errorf("failed to read CSV after %d imported rows: %v", rowCount-writer.rollback(), err)
+		}
+
+		values := make([]interface{}, len(record))
+		for i, field := range record {
+			values[i], err = parseCSVValue(field, types[i], nullValue)
+			if err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = encryptValues(values, encryptIndexes, opts.encryptor)
+		}
+		if err != nil {
+			log.Printf("Error converting line %d: %v\n", lineNumber, err)
+			dead.record(ctx, lineNumber, header, values, err)
+			failedCount++
+			continue
+		}
+
+		args = append(append(args[:0], values...), constants...)
+		if _, err := writer.exec(ctx, args...); err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("import stopped after %d rows: %v", rowCount-writer.rollback(), ctx.Err())
+			}
+			log.Printf("Error inserting line %d: %v\n", lineNumber, err)
+			if opts.logFailedSQL {
+				log.Printf("Failed statement for line %d: %s\n", lineNumber, renderStatement(insertStmt, args))
+			}
+			dead.record(ctx, lineNumber, header, values, err)
+			failedCount++
+			continue
+		}
+		rowCount++
+		if err := writer.rowDone(); err != nil {
+			return fmt.Errorf("import stopped after %d rows: %v", rowCount-writer.rollback(), err)
+		}
+	}
+	if err := writer.commit(); err != nil {
+		return fmt.Errorf("import stopped after %d rows: %v", rowCount-writer.rollback(), err)
+	}
+	if err := writer.finalize(ctx); err != nil {
+		return err
+	}
+
+	if failedCount > 0 {
+		return fmt.Errorf("%d of %d lines failed to import into '%s', %d rows were imported", failedCount, failedCount+rowCount, destTable, rowCount)
+	}
+	progressf("Import completed successfully. Total rows imported: %d\n", rowCount)
+	return nil
+}
+
+// parseCSVValue converts a CSV field to a value suitable for a column of the given type
+func parseCSVValue(field string, columnType *sql.ColumnType, nullValue string) (interface{}, error) {
+	if nullable, ok := columnType.Nullable(); field == nullValue && (nullable || !ok) {
+		return nil, nil
+	}
+
+	typeName := columnType.DatabaseTypeName()
+	if binaryCSVTypes[typeName] {
+		v, err := base64.StdEncoding.DecodeString(field)
+		if err != nil {
+			return nil, fmt.Errorf("column '%s' holds invalid base64: %v", columnType.Name(), err)
+		}
+		return v, nil
+	}
+	switch typeName {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "YEAR":
+		v, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("column '%s': %v", columnType.Name(), err)
+		}
+		return v, nil
+	// Unsigned values above math.MaxInt64 only fit in a uint64
+	case "UNSIGNED TINYINT", "UNSIGNED SMALLINT", "UNSIGNED MEDIUMINT", "UNSIGNED INT", "UNSIGNED BIGINT":
+		v, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("column '%s': %v", columnType.Name(), err)
+		}
+		return v, nil
+	case "FLOAT", "DOUBLE":
+		v, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil, fmt.Errorf("column '%s': %v", columnType.Name(), err)
+		}
+		return v, nil
+	case "JSON":
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, []byte(field)); err != nil {
+			return nil, fmt.Errorf("column '%s' holds invalid JSON: %v", columnType.Name(), err)
+		}
+		return buf.String(), nil
+	}
+	return field, nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFormatCSVValue(t *testing.T) {
+	tests := []struct {
+		val      interface{}
+		typeName string
+		want     string
+	}{
+		{nil, "BLOB", `\N`},
+		{"text", "VARCHAR", "text"},
+		{[]byte("text"), "VARCHAR", "text"},
+		// Binary values may hold any bytes, scanned as a string or kept as []byte
+		{"\x00\xff", "BLOB", "AP8="},
+		{[]byte{0x00, 0xff}, "GEOMETRY", "AP8="},
+		{int64(42), "INT", "42"},
+	}
+	for _, tt := range tests {
+		if got := formatCSVValue(tt.val, tt.typeName, `\N`); got != tt.want {
+			t.Errorf("formatCSVValue(%#v, %q) = %q, want %q", tt.val, tt.typeName, got, tt.want)
+		}
+	}
+}
+
+func TestImportCSVFailedLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "forms.csv")
+	// One line converts and inserts, one does not convert and one fails to insert
+	if err := os.WriteFile(path, []byte("id,name\n1,a\nx,b\n3,duplicate\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dst := &fakeDB{
+		query: func(string, []driver.Value) *fakeRows {
+			return &fakeRows{cols: []string{"id", "name"}, typeNames: []string{"INT", "VARCHAR"}}
+		},
+		exec: func(_ string, args []driver.Value) error {
+			if len(args) > 1 && args[1] == "duplicate" {
+				return errors.New("Duplicate entry '3' for key 'PRIMARY'")
+			}
+			return nil
+		},
+	}
+	err := importCSV(context.Background(), openFake(t, dst), "forms", path, `\N`, migrationOptions{})
+	if err == nil || err.Error() != "2 of 3 lines failed to import into 'forms', 1 rows were imported" {
+		t.Errorf("importCSV() error = %v, want 2 of 3 lines failed", err)
+	}
+
+	if err := os.WriteFile(path, []byte("id,name\n1,a\n2,b\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := importCSV(context.Background(), openFake(t, dst), "forms", path, `\N`, migrationOptions{}); err != nil {
+		t.Errorf("importCSV() error = %v, want none", err)
+	}
+}
+
+func TestParseCSVValue(t *testing.T) {
+	typeNames := []string{"INT", "UNSIGNED INT", "UNSIGNED BIGINT", "DOUBLE", "JSON", "VARCHAR", "BLOB"}
+	cols := []string{"i", "ui", "ubig", "d", "doc", "s", "b"}
+	db := openFake(t, &fakeDB{query: func(string, []driver.Value) *fakeRows {
+		return &fakeRows{cols: cols, typeNames: typeNames}
+	}})
+	rows, err := db.Query("SELECT * FROM t LIMIT 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		column  int
+		field   string
+		want    interface{}
+		wantErr bool
+	}{
+		{0, "-42", int64(-42), false},
+		{0, "x", nil, true},
+		{1, "4294967295", uint64(4294967295), false},
+		{2, "18446744073709551615", uint64(18446744073709551615), false},
+		{2, "-1", nil, true},
+		{3, "1.5", 1.5, false},
+		{4, "{ \"a\": 1 }", `{"a":1}`, false},
+		{4, "{", nil, true},
+		{5, "text", "text", false},
+		{5, `\N`, nil, false},
+		{6, "AP8=", []byte{0x00, 0xff}, false},
+		{6, "", []byte{}, false},
+		{6, "not base64", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseCSVValue(tt.field, columnTypes[tt.column], `\N`)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseCSVValue(%q) as %s error = %v, want error %v", tt.field, typeNames[tt.column], err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseCSVValue(%q) as %s = %#v, want %#v", tt.field, typeNames[tt.column], got, tt.want)
+		}
+	}
+}
+
+// keyedTable is a scripted destination table of id and name keyed by id. Like MySQL, an
+// INSERT of an existing id fails and a REPLACE overwrites the row.
+type keyedTable struct {
+	mu   sync.Mutex
+	rows map[int64]string
+}
+
+func (k *keyedTable) fake() *fakeDB {
+	return &fakeDB{
+		query: func(string, []driver.Value) *fakeRows {
+			return &fakeRows{cols: []string{"id", "name", "source"}, typeNames: []string{"INT", "VARCHAR", "VARCHAR"}}
+		},
+		exec: func(query string, args []driver.Value) error {
+			if !strings.Contains(query, "INTO forms") {
+				return nil
+			}
+			k.mu.Lock()
+			defer k.mu.Unlock()
+			id := args[0].(int64)
+			if _, ok := k.rows[id]; ok && strings.HasPrefix(query, "INSERT") {
+				return fmt.Errorf("Duplicate entry '%d' for key 'PRIMARY'", id)
+			}
+			k.rows[id] = fmt.Sprint(args[1], " ", args[2])
+			return nil
+		},
+	}
+}
+
+func TestImportCSVOnConflict(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "forms.csv")
+	if err := os.WriteFile(path, []byte("id,name\n1,new\n2,b\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		onConflict string
+		want       map[int64]string
+		wantErr    bool
+	}{
+		// The conflicting row is skipped, reported and left as it was
+		{"error", map[int64]string{1: "old", 2: "b csv"}, true},
+		{"replace", map[int64]string{1: "new csv", 2: "b csv"}, false},
+	}
+	for _, tt := range tests {
+		table := &keyedTable{rows: map[int64]string{1: "old"}}
+		dst := table.fake()
+		opts := migrationOptions{
+			onConflict:         tt.onConflict,
+			rowsPerTransaction: 10,
+			setColumns:         columnValues{{column: "source", value: "csv"}},
+			deadLetterTable:    "dead_letters",
+		}
+		err := importCSV(context.Background(), openFake(t, dst), "forms", path, `\N`, opts)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("-onConflict %s: importCSV() error = %v, want error %v", tt.onConflict, err, tt.wantErr)
+		}
+		if !reflect.DeepEqual(table.rows, tt.want) {
+			t.Errorf("-onConflict %s: table holds %v, want %v", tt.onConflict, table.rows, tt.want)
+		}
+		if recorded := dst.ran("INSERT INTO dead_letters"); recorded != tt.wantErr {
+			t.Errorf("-onConflict %s: failed line recorded in the dead-letter table = %v, want %v", tt.onConflict, recorded, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+	"unicode/utf8"
+)
+
+// deadLetterSchema is the layout of the -deadLetterTable. Rows are kept as JSON text in
+// a LONGTEXT column, which every MySQL and MariaDB version accepts; logged_row is the
+// number the log reports the row under.
+const deadLetterSchema = `(
+	id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	source_table VARCHAR(255) NOT NULL,
+	dest_table VARCHAR(255) NOT NULL,
+	logged_row BIGINT NOT NULL,
+	row_data LONGTEXT NOT NULL,
+	error TEXT NOT NULL,
+	failed_at DATETIME NOT NULL
+)`
+
+// deadLetters records the rows of one table that failed to insert in the -deadLetterTable
+// on the destination. A nil deadLetters records nothing.
+type deadLetters struct {
+	db          *sql.DB
+	table       string
+	sourceTable string
+	destTable   string
+}
+
+// openDeadLetters creates the dead-letter table on dstDB if it does not exist yet
+func openDeadLetters(ctx context.Context, dstDB *sql.DB, table, sourceTable, destTable string) (*deadLetters, error) {
+	if _, err := dstDB.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s %s", table, deadLetterSchema)); err != nil {
+		return nil, fmt.Errorf("failed to create dead-letter table '%s': %v", table, err)
+	}
+	return &deadLetters{db: dstDB, table: table, sourceTable: sourceTable, destTable: destTable}, nil
+}
+
+// record stores a failed row as a JSON object of its columns with the error. The row is
+// written outside the copy's transaction, so a later rollback keeps it, and a failure to
+// write it is only logged rather than stopping the copy.
+func (d *deadLetters) record(ctx context.Context, rowNumber int, cols []string, values []interface{}, rowErr error) {
+	if d == nil {
+		return
+	}
+	data, err := rowJSON(cols, values)
+	if err != nil {
+		log.Printf("Error recording row %d in dead-letter table: %v\n", rowNumber, err)
+		return
+	}
+	query := fmt.Sprintf("INSERT INTO %s (source_table, dest_table, logged_row, row_data, error, failed_at) VALUES (?, ?, ?, ?, ?, ?)", d.table)
+	if _, err := d.db.ExecContext(ctx, query, d.sourceTable, d.destTable, rowNumber, data, rowErr.Error(), time.Now().UTC()); err != nil {
+		log.Printf("Error recording row %d in dead-letter table: %v\n", rowNumber, err)
+	}
+}
+
+// rowJSON encodes a row as a JSON object by column name. Binary values that are not
+// valid UTF-8 are base64-encoded, as encoding/json does for byte slices.
+func rowJSON(cols []string, values []interface{}) (string, error) {
+	row := make(map[string]interface{}, len(cols))
+	for i, col := range cols {
+		value := values[i]
+		if b, ok := value.([]byte); ok && utf8.Valid(b) {
+			value = string(b)
+		}
+		row[col] = value
+	}
+	data, err := json.Marshal(row)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
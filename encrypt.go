@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Encryptor encrypts column values before they are inserted into the destination.
+// Key management backends such as a KMS plug in by implementing it.
+type Encryptor interface {
+	Encrypt(plaintext []byte) ([]byte, error)
+}
+
+// aesGCMEncryptor encrypts with AES-GCM, prefixing each ciphertext with its random nonce
+type aesGCMEncryptor struct {
+	aead cipher.AEAD
+}
+
+// newAESGCMEncryptor reads a hex-encoded 16, 24 or 32 byte AES key from keyFile
+func newAESGCMEncryptor(keyFile string) (*aesGCMEncryptor, error) {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encryption key file: %v", err)
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("encryption key file must hold a hex-encoded key: %v", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &aesGCMEncryptor{aead: aead}, nil
+}
+
+func (e *aesGCMEncryptor) Encrypt(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, e.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	return e.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// binaryColumnTypes are the destination types that can hold ciphertext unchanged
+var binaryColumnTypes = []string{"binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob"}
+
+// encryptedColumnIndexes returns the positions of the encrypted columns within cols,
+// checking that each exists in the source and is binary in the destination
+func encryptedColumnIndexes(cols []string, encryptColumns []string, destColumns []columnInfo) ([]int, error) {
+	destTypes := make(map[string]string, len(destColumns))
+	for _, column := range destColumns {
+		destTypes[column.name] = strings.ToLower(column.columnType)
+	}
+
+	indexes := columnIndexes(cols, encryptColumns)
+	if len(indexes) != len(encryptColumns) {
+		return nil, fmt.Errorf("-encryptColumns names columns missing from the source: %v", encryptColumns)
+	}
+	for _, col := range encryptColumns {
+		destType := destTypes[col]
+		binary := false
+		for _, binaryType := range binaryColumnTypes {
+			if destType == binaryType || strings.HasPrefix(destType, binaryType+"(") {
+				binary = true
+				break
+			}
+		}
+		if !binary {
+			return nil, fmt.Errorf("encrypted column '%s' must be VARBINARY or BLOB in the destination, got '%s'", col, destType)
+		}
+	}
+	return indexes, nil
+}
+
+// encryptValues replaces the values at indexes with their ciphertext. NULLs stay NULL.
+func encryptValues(values []interface{}, indexes []int, encryptor Encryptor) error {
+	for _, index := range indexes {
+		var plaintext []byte
+		switch v := values[index].(type) {
+		case nil:
+			continue
+		case []byte:
+			plaintext = v
+		case string:
+			plaintext = []byte(v)
+		default:
+			plaintext = []byte(fmt.Sprint(v))
+		}
+		ciphertext, err := encryptor.Encrypt(plaintext)
+		if err != nil {
+			return err
+		}
+		values[index] = ciphertext
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// foreignKey is a foreign key constraint of a destination table
+type foreignKey struct {
+	name             string
+	table            string
+	columns          []string
+	referencedSchema string
+	referencedTable  string
+	referencedCols   []string
+}
+
+// getForeignKeys returns the foreign keys defined on a table
+func getForeignKeys(db *sql.DB, tableName string) ([]foreignKey, error) {
+	query := `SELECT constraint_name, column_name, referenced_table_schema, referenced_table_name, referenced_column_name
+		FROM information_schema.key_column_usage
+		WHERE table_schema = COALESCE(?, DATABASE()) AND table_name = ? AND referenced_table_name IS NOT NULL
+		ORDER BY constraint_name, ordinal_position`
+	schema, table := splitTableName(tableName)
+	rows, err := db.Query(query, schema, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query foreign keys: %v", err)
+	}
+	defer rows.Close()
+
+	var keys []foreignKey
+	for rows.Next() {
+		var name, column, refSchema, refTable, refColumn string
+		if err := rows.Scan(&name, &column, &refSchema, &refTable, &refColumn); err != nil {
+			return nil, fmt.Errorf("failed to scan foreign key: %v", err)
+		}
+		if len(keys) == 0 || keys[len(keys)-1].name != name {
+			keys = append(keys, foreignKey{name: name, table: tableName, referencedSchema: refSchema, referencedTable: refTable})
+		}
+		key := &keys[len(keys)-1]
+		key.columns = append(key.columns, column)
+		key.referencedCols = append(key.referencedCols, refColumn)
+	}
+	return keys, rows.Err()
+}
+
+// countOrphans counts child rows whose non-NULL foreign key has no matching parent row
+func countOrphans(db *sql.DB, key foreignKey) (int, error) {
+	var join, notNull []string
+	for i, column := range key.columns {
+		join = append(join, fmt.Sprintf("c.`%s` = p.`%s`", column, key.referencedCols[i]))
+		notNull = append(notNull, fmt.Sprintf("c.`%s` IS NOT NULL", column))
+	}
+
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s c LEFT JOIN `%s`.`%s` p ON %s WHERE p.`%s` IS NULL AND %s",
+		quoteTableName(key.table), key.referencedSchema, key.referencedTable, strings.Join(join, " AND "),
+		key.referencedCols[0], strings.Join(notNull, " AND "))
+
+	var count int
+	if err := db.QueryRow(query).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count orphans for '%s': %v", key.name, err)
+	}
+	return count, nil
+}
+
+// validateForeignKeys reports the orphaned child rows of every foreign key on the
+// migrated destination tables. It reports whether no orphans were found.
+func validateForeignKeys(db *sql.DB, tables []tablePair) (bool, error) {
+	valid := true
+	for _, table := range tables {
+		keys, err := getForeignKeys(db, table.dest)
+		if err != nil {
+			return false, fmt.Errorf("table '%s': %v", table.dest, err)
+		}
+
+		for _, key := range keys {
+			orphans, err := countOrphans(db, key)
+			if err != nil {
+				return false, err
+			}
+			fmt.Printf("Foreign key %s.%s -> %s: %d orphaned rows\n", table.dest, key.name, key.referencedTable, orphans)
+			if orphans > 0 {
+				valid = false
+			}
+		}
+	}
+	return valid, nil
+}
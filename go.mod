@@ -2,7 +2,12 @@ module jotform-data-migrate-2
 
 go 1.22.2
 
+require (
+	github.com/go-sql-driver/mysql v1.8.1
+	golang.org/x/term v0.25.0
+)
+
 require (
 	filippo.io/edwards25519 v1.1.0 // indirect
-	github.com/go-sql-driver/mysql v1.8.1 // indirect
+	golang.org/x/sys v0.26.0 // indirect
 )
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// startHeartbeat logs a still-alive message with the running row count every interval,
+// whether or not rows are flowing. The returned stop function ends the heartbeat and
+// waits for its goroutine to exit; cancelling ctx also ends it.
+func startHeartbeat(ctx context.Context, interval time.Duration, rowsMigrated *atomic.Int64) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				log.Printf("Still working, %d rows migrated so far\n", rowsMigrated.Load())
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
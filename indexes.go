@@ -0,0 +1,144 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// indexInfo describes a secondary index as reported by information_schema.statistics
+type indexInfo struct {
+	name      string
+	indexType string // BTREE, HASH, FULLTEXT or SPATIAL
+	unique    bool
+	keyParts  []indexKeyPart
+}
+
+// indexKeyPart is one column of an index
+type indexKeyPart struct {
+	column     string
+	prefix     int64 // indexed prefix length, 0 for the whole column
+	descending bool
+}
+
+// getIndexes returns the secondary indexes of a table, without the primary key.
+// Functional key parts cannot be reproduced, indexes using them are skipped with a warning.
+func getIndexes(db *sql.DB, tableName string) ([]indexInfo, error) {
+	query := "SELECT index_name, index_type, non_unique, column_name, sub_part, collation FROM information_schema.statistics WHERE table_schema = COALESCE(?, DATABASE()) AND table_name = ? AND index_name <> 'PRIMARY' ORDER BY index_name, seq_in_index"
+	schema, table := splitTableName(tableName)
+	rows, err := db.Query(query, schema, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query indexes: %v", err)
+	}
+	defer rows.Close()
+
+	var indexes []indexInfo
+	skipped := make(map[string]bool)
+	for rows.Next() {
+		var name, indexType string
+		var nonUnique int
+		var column, collation sql.NullString
+		var subPart sql.NullInt64
+		if err := rows.Scan(&name, &indexType, &nonUnique, &column, &subPart, &collation); err != nil {
+			return nil, fmt.Errorf("failed to scan index: %v", err)
+		}
+		if !column.Valid {
+			if !skipped[name] {
+				log.Printf("Warning: index '%s' of '%s' has a functional key part and is not reproduced\n", name, tableName)
+			}
+			skipped[name] = true
+		}
+		if skipped[name] {
+			continue
+		}
+
+		if len(indexes) == 0 || indexes[len(indexes)-1].name != name {
+			indexes = append(indexes, indexInfo{name: name, indexType: indexType, unique: nonUnique == 0})
+		}
+		last := &indexes[len(indexes)-1]
+		last.keyParts = append(last.keyParts, indexKeyPart{column: column.String, prefix: subPart.Int64, descending: collation.String == "D"})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// An index may turn out to be functional after its first key parts were collected
+	kept := indexes[:0]
+	for _, index := range indexes {
+		if !skipped[index.name] {
+			kept = append(kept, index)
+		}
+	}
+	return kept, nil
+}
+
+// indexDefinition renders an index as a CREATE TABLE clause. FULLTEXT and SPATIAL
+// indexes have their own keyword and take neither prefix lengths nor a direction.
+func indexDefinition(index indexInfo) string {
+	special := index.indexType == "FULLTEXT" || index.indexType == "SPATIAL"
+	keyword := "KEY"
+	switch {
+	case special:
+		keyword = index.indexType + " KEY"
+	case index.unique:
+		keyword = "UNIQUE KEY"
+	}
+
+	keyParts := make([]string, len(index.keyParts))
+	for i, part := range index.keyParts {
+		keyParts[i] = fmt.Sprintf("`%s`", part.column)
+		if special {
+			continue
+		}
+		if part.prefix > 0 {
+			keyParts[i] += fmt.Sprintf("(%d)", part.prefix)
+		}
+		if part.descending {
+			keyParts[i] += " DESC"
+		}
+	}
+	return fmt.Sprintf("%s `%s` (%s)", keyword, index.name, strings.Join(keyParts, ", "))
+}
+
+// completeTable adds the source indexes and CHECK constraints an existing destination
+// table lacks, for -completeSchema. Foreign keys are not reproduced on created tables
+// either, so they are not completed.
+func completeTable(srcDB, destDB *sql.DB, sourceTable, destTable string) error {
+	if err := addMissingIndexes(srcDB, destDB, sourceTable, destTable); err != nil {
+		return err
+	}
+	return addMissingChecks(srcDB, destDB, sourceTable, destTable)
+}
+
+// addMissingIndexes adds the source indexes the existing destination table lacks, by
+// index name, so creating the schema again completes a table left without some of its
+// indexes, such as by a run interrupted while they were being rebuilt. Indexes already
+// present are skipped even when defined differently.
+func addMissingIndexes(srcDB, destDB *sql.DB, sourceTable, destTable string) error {
+	srcIndexes, err := getIndexes(srcDB, sourceTable)
+	if err != nil {
+		return err
+	}
+	destIndexes, err := getIndexes(destDB, destTable)
+	if err != nil {
+		return err
+	}
+	present := make(map[string]bool, len(destIndexes))
+	for _, index := range destIndexes {
+		present[index.name] = true
+	}
+
+	for _, index := range srcIndexes {
+		if present[index.name] {
+			progressf("Index '%s' already exists on '%s', skipping\n", index.name, destTable)
+			continue
+		}
+		statement := fmt.Sprintf("ALTER TABLE %s ADD %s", destTable, indexDefinition(index))
+		if _, err := destDB.Exec(statement); err != nil {
+			return fmt.Errorf("failed to add index '%s': %v\ngenerated statement: %s", index.name, err, statement)
+		}
+		progressf("Index '%s' added to existing table '%s'\n", index.name, destTable)
+	}
+	return nil
+}
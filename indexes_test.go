@@ -0,0 +1,121 @@
+package main
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestIndexDefinition(t *testing.T) {
+	tests := []struct {
+		index indexInfo
+		want  string
+	}{
+		{
+			indexInfo{name: "idx_user", indexType: "BTREE", keyParts: []indexKeyPart{{column: "user_id"}, {column: "created_at", descending: true}}},
+			"KEY `idx_user` (`user_id`, `created_at` DESC)",
+		},
+		{
+			indexInfo{name: "uniq_email", indexType: "BTREE", unique: true, keyParts: []indexKeyPart{{column: "email", prefix: 100}}},
+			"UNIQUE KEY `uniq_email` (`email`(100))",
+		},
+		{
+			indexInfo{name: "ft_body", indexType: "FULLTEXT", keyParts: []indexKeyPart{{column: "title"}, {column: "body"}}},
+			"FULLTEXT KEY `ft_body` (`title`, `body`)",
+		},
+		{
+			// Prefixes and directions reported for a spatial index are not valid DDL
+			indexInfo{name: "sp_location", indexType: "SPATIAL", keyParts: []indexKeyPart{{column: "location", prefix: 32, descending: true}}},
+			"SPATIAL KEY `sp_location` (`location`)",
+		},
+	}
+	for _, tt := range tests {
+		if got := indexDefinition(tt.index); got != tt.want {
+			t.Errorf("indexDefinition(%s) = %q, want %q", tt.index.name, got, tt.want)
+		}
+	}
+}
+
+// indexRows are information_schema.statistics rows of getIndexes
+func indexRows(rows [][]driver.Value) *fakeRows {
+	return &fakeRows{cols: []string{"index_name", "index_type", "non_unique", "column_name", "sub_part", "collation"}, rows: rows}
+}
+
+func TestAddMissingIndexesTwice(t *testing.T) {
+	srcIndexes := [][]driver.Value{
+		{"ft_body", "FULLTEXT", int64(1), "body", nil, nil},
+		{"idx_user", "BTREE", int64(1), "user_id", nil, "A"},
+		{"sp_location", "SPATIAL", int64(1), "location", int64(32), "A"},
+	}
+	src := openFake(t, &fakeDB{query: func(string, []driver.Value) *fakeRows { return indexRows(srcIndexes) }})
+
+	// The destination already has idx_user and gains every index it is altered with
+	var mu sync.Mutex
+	destIndexes := [][]driver.Value{srcIndexes[1]}
+	dest := &fakeDB{
+		query: func(string, []driver.Value) *fakeRows {
+			mu.Lock()
+			defer mu.Unlock()
+			return indexRows(append([][]driver.Value(nil), destIndexes...))
+		},
+		exec: func(query string, _ []driver.Value) error {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, row := range srcIndexes {
+				if strings.Contains(query, "`"+row[0].(string)+"`") {
+					destIndexes = append(destIndexes, row)
+				}
+			}
+			return nil
+		},
+	}
+	destDB := openFake(t, dest)
+
+	for run := 1; run <= 2; run++ {
+		if err := addMissingIndexes(src, destDB, "forms", "forms"); err != nil {
+			t.Fatalf("run %d: addMissingIndexes() error = %v", run, err)
+		}
+	}
+
+	var alters []string
+	for _, statement := range dest.statements {
+		if strings.HasPrefix(statement, "ALTER TABLE") {
+			alters = append(alters, statement)
+		}
+	}
+	want := []string{
+		"ALTER TABLE forms ADD FULLTEXT KEY `ft_body` (`body`)",
+		"ALTER TABLE forms ADD SPATIAL KEY `sp_location` (`location`)",
+	}
+	if !reflect.DeepEqual(alters, want) {
+		t.Errorf("two runs altered the table with %q, want %q once", alters, want)
+	}
+}
+
+func TestCreateTableIfNotExistsCompletesOnlyWhenAsked(t *testing.T) {
+	srcIndexes := [][]driver.Value{{"idx_user", "BTREE", int64(1), "user_id", nil, "A"}}
+	src := openFake(t, &fakeDB{query: func(query string, _ []driver.Value) *fakeRows {
+		if strings.Contains(query, "information_schema.statistics") {
+			return indexRows(srcIndexes)
+		}
+		return nil
+	}})
+	for _, complete := range []bool{false, true} {
+		// The destination table exists without any index
+		dest := &fakeDB{query: func(query string, _ []driver.Value) *fakeRows {
+			if strings.Contains(query, "information_schema.tables") {
+				return &fakeRows{cols: []string{"table_name"}, rows: [][]driver.Value{{"forms"}}}
+			}
+			return nil
+		}}
+		created, err := createTableIfNotExists(src, openFake(t, dest), "forms", "forms", ddlOptions{completeSchema: complete})
+		if err != nil || created {
+			t.Fatalf("createTableIfNotExists() = %v, %v, want an existing table", created, err)
+		}
+		if altered := dest.ran("ALTER TABLE"); altered != complete {
+			t.Errorf("-completeSchema %v: table altered = %v, want %v", complete, altered, complete)
+		}
+	}
+}
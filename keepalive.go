@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sync"
+	"time"
+)
+
+// startKeepalive pings the destination connection every interval so the server's
+// wait_timeout does not close it while a slow source query produces its first rows.
+// The returned stop function ends the pings and waits for them to finish, so the
+// connection is free for inserts once it returns; stop may be called more than once.
+func startKeepalive(ctx context.Context, conn *sql.Conn, interval time.Duration) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := conn.PingContext(ctx); err != nil && ctx.Err() == nil {
+					log.Printf("Warning: destination keep-alive ping failed: %v\n", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// disableKeys defers the secondary index maintenance of a freshly created table so
+// the copy only writes rows. MyISAM tables use DISABLE KEYS; InnoDB has no equivalent,
+// so its non-unique indexes are dropped. Unique indexes stay to keep rejecting
+// duplicates. The returned enable function rebuilds the indexes and reports how long
+// that took; it must be called whether or not the copy succeeded.
+func disableKeys(db *sql.DB, table string) (enable func() error, err error) {
+	engine, err := getTableEngine(db, table)
+	if err != nil {
+		return nil, err
+	}
+
+	var rebuild []string
+	switch engine {
+	case "MyISAM", "Aria":
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s DISABLE KEYS", table)); err != nil {
+			return nil, fmt.Errorf("error disabling keys: %v", err)
+		}
+		rebuild = []string{fmt.Sprintf("ALTER TABLE %s ENABLE KEYS", table)}
+	case "InnoDB":
+		indexes, err := getIndexes(db, table)
+		if err != nil {
+			return nil, err
+		}
+		var drops, adds []string
+		for _, index := range indexes {
+			if index.unique {
+				continue
+			}
+			drops = append(drops, fmt.Sprintf("DROP INDEX `%s`", index.name))
+			// InnoDB builds one FULLTEXT index per ALTER TABLE, so each is added separately;
+			// the others are added in a single ALTER that scans the table once
+			if index.indexType == "FULLTEXT" {
+				rebuild = append(rebuild, fmt.Sprintf("ALTER TABLE %s ADD %s", table, indexDefinition(index)))
+				continue
+			}
+			adds = append(adds, "ADD "+indexDefinition(index))
+		}
+		if len(adds) > 0 {
+			rebuild = append([]string{fmt.Sprintf("ALTER TABLE %s %s", table, strings.Join(adds, ", "))}, rebuild...)
+		}
+		if len(drops) > 0 {
+			if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s %s", table, strings.Join(drops, ", "))); err != nil {
+				return nil, fmt.Errorf("error dropping indexes: %v", err)
+			}
+		}
+	default:
+		log.Printf("Warning: cannot defer index maintenance of %s table '%s', loading with keys enabled\n", engine, table)
+	}
+
+	return func() error {
+		if len(rebuild) == 0 {
+			return nil
+		}
+		start := time.Now()
+		for _, statement := range rebuild {
+			if _, err := db.Exec(statement); err != nil {
+				return fmt.Errorf("error rebuilding indexes of '%s' (%s): %v", table, statement, err)
+			}
+		}
+		progressf("Rebuilt indexes of '%s' in %s\n", table, time.Since(start).Round(time.Millisecond))
+		return nil
+	}, nil
+}
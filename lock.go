@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// maxLockNameLength is the longest advisory lock name MySQL 5.7 and later accept
+const maxLockNameLength = 64
+
+// tableLockName returns the -lock name of a destination table, prefix followed by
+// database.table. Names over the server limit end in a hash of database.table instead.
+func tableLockName(prefix, database, table string) string {
+	name := prefix + database + "." + table
+	if len(name) <= maxLockNameLength {
+		return name
+	}
+	name = fmt.Sprintf("%s%x", prefix, sha256.Sum256([]byte(database+"."+table)))
+	return name[:maxLockNameLength]
+}
+
+// acquireTableLock takes the advisory lock of a destination table, waiting up to timeout
+// for another run holding it. Advisory locks belong to the session that took them, so
+// the lock is held on a connection of its own until release is called. The server also
+// frees the lock when that connection closes, so a run that is cancelled or dies while
+// holding it does not leave it behind.
+func acquireTableLock(ctx context.Context, dstDB *sql.DB, prefix, destTable string, timeout time.Duration) (release func(), err error) {
+	conn, err := dstDB.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock connection: %v", err)
+	}
+	schema, table := splitTableName(destTable)
+	var database sql.NullString
+	if err := conn.QueryRowContext(ctx, "SELECT COALESCE(?, DATABASE())", schema).Scan(&database); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to query destination database: %v", err)
+	}
+	name := tableLockName(prefix, database.String, table)
+
+	// GET_LOCK returns 1 once acquired, 0 on timeout and NULL on errors
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", name, int(timeout.Seconds())).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to acquire lock '%s': %v", name, err)
+	}
+	if acquired.Int64 != 1 {
+		conn.Close()
+		return nil, fmt.Errorf("lock '%s' is held by another run, gave up after %v", name, timeout)
+	}
+	progressf("Acquired lock '%s'\n", name)
+
+	// The run's context may be cancelled by now, which must not keep the lock held
+	return func() {
+		if _, err := conn.ExecContext(context.Background(), "DO RELEASE_LOCK(?)", name); err != nil {
+			log.Printf("Warning: failed to release lock '%s', it is freed as the connection closes: %v\n", name, err)
+		}
+		conn.Close()
+	}, nil
+}
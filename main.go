@@ -1,16 +1,42 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net/url"
+	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 )
 
 func main() {
+	// An optional leading subcommand selects a mode other than migrating
+	command := ""
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	switch command {
+	case "", "compare", "schema-diff", "benchmark", "healthcheck":
+	default:
+		log.Fatalf("Unknown command '%s'", command)
+	}
+
 	// Command-line flags for DB connection details
 	sourceDBHost := flag.String("sourceHost", "", "IP address of the source database server")
 	destDBHost := flag.String("destHost", "", "IP address of the destination database server")
@@ -19,74 +45,877 @@ func main() {
 	sourceTableName := flag.String("sourceTable", "", "Name of the source table")
 	destTableName := flag.String("destTable", "", "Name of the destination table")
 	dbUser := flag.String("dbUser", "root", "Database user")
-	dbPassword := flag.String("dbPassword", "password", "Database password")
+	dbPassword := flag.String("dbPassword", "password", "Database password; prompted for on a terminal when not given here or in -defaultsFile")
+	sourceIsolation := flag.String("sourceIsolation", "", "Isolation level for the source read transaction (repeatable-read, read-committed, serializable)")
+	tablesFile := flag.String("tablesFile", "", "File listing table pairs to migrate, one 'srcTable:dstTable' or 'table' per line")
+	output := flag.String("output", "", "File to export the source rows to instead of inserting into the destination ('-' for stdout)")
+	outputFormat := flag.String("outputFormat", "csv", "Format of the -output file (csv)")
+	compress := flag.String("compress", "", "Compression of the -output file (gzip)")
+	csvNull := flag.String("csvNull", "", "Value representing NULL fields in CSV output and input")
+	tableConcurrency := flag.Int("tableConcurrency", 1, "Number of tables migrated in parallel")
+	stopOnError := flag.Bool("stopOnError", true, "Stop the whole run (cancelling in-flight tables) when a table fails")
+	connectRetries := flag.Int("connectRetries", 0, "Number of times to retry connecting to a database that is unreachable or starting up")
+	connectRetryInterval := flag.Duration("connectRetryInterval", 2*time.Second, "Delay between connection retries")
+	slowRowThreshold := flag.Duration("slowRowThreshold", 0, "Log a warning for inserts slower than this duration (0 disables)")
+	heartbeat := flag.Duration("heartbeat", 0, "Log a still-alive message with the row count at this interval (0 disables)")
+	captureBinlogPos := flag.Bool("captureBinlogPos", false, "Record the source binlog file/position each table snapshot is read at (requires REPLICATION CLIENT)")
+	captureGTID := flag.Bool("captureGTID", false, "Record the source @@GLOBAL.gtid_executed each table snapshot is read at, for GTID-based CDC (requires gtid_mode ON)")
+	binlogPosFile := flag.String("binlogPosFile", "", "File to write the captured binlog positions and GTID sets to as JSON")
+	inputCSV := flag.String("inputCSV", "", "CSV file (with header) to import into the destination table instead of reading the source")
+	schemaOnly := flag.Bool("printSchema", false, "Print the CREATE TABLE statement generated for the source table and exit")
+	validateOnly := flag.Bool("validateOnly", false, "Check connectivity, table existence and schema compatibility without copying any data")
+	profile := flag.Bool("profile", false, "With -validateOnly, also report per-column NULL, empty string, min/max and distinct value counts of the source rows (runs aggregate queries on the source)")
+	autoTimestamps := flag.String("autoTimestamps", "", "Comma-separated columns created with DEFAULT CURRENT_TIMESTAMP (e.g. created_at,updated_at)")
+
+	// TIMESTAMP values are stored in UTC and converted to and from the session time zone,
+	// so pinning both sessions to the same zone (e.g. +00:00) copies them without shifting
+	sourceTimeZone := flag.String("sourceTimeZone", "", "Session time_zone for source connections (e.g. +00:00)")
+	destTimeZone := flag.String("destTimeZone", "", "Session time_zone for destination connections (e.g. +00:00)")
+	nullToDefault := flag.Bool("nullToDefault", false, "Insert the destination column default instead of NULL into NOT NULL columns that have one")
+	rowsPerTransaction := flag.Int("rowsPerTransaction", 0, "Commit destination inserts in transactions of this many rows (0 autocommits every row)")
+	logWarnings := flag.Bool("logWarnings", false, "Run SHOW WARNINGS after every insert and log what MySQL truncated or coerced")
+	strictWarnings := flag.Bool("strictWarnings", false, "Fail the table when an insert raises warnings (implies -logWarnings)")
+	stagingSwap := flag.Bool("stagingSwap", false, "Copy into <destTable>__staging and atomically swap it in for the destination table on success")
+	validateFKs := flag.Bool("validateForeignKeys", false, "After migrating, count child rows violating each destination foreign key and fail if any are found")
+	disableKeysDuringLoad := flag.Bool("disableKeysDuringLoad", false, "For tables created by this run, defer secondary index maintenance until the copy is done (DISABLE KEYS on MyISAM, drop and re-add non-unique indexes on InnoDB)")
+	snapshotFile := flag.String("snapshotFile", "", "Development/testing only: read the source rows from this file if it exists, otherwise from the source while recording them there. The snapshot ignores later source and filter changes")
+	refreshSnapshot := flag.Bool("refreshSnapshot", false, "Read from the source and record -snapshotFile again even if it exists")
+	var destInitSQL, destFinalizeSQL stringList
+	flag.Var(&destInitSQL, "destInitSQL", "Statement run on each table's destination connection before copying, repeatable (e.g. 'SET unique_checks=0')")
+	flag.Var(&destFinalizeSQL, "destFinalizeSQL", "Statement run on each table's destination connection after copying, repeatable")
+	destShards := flag.String("destShards", "", "Comma-separated destination databases to spread rows over by CRC32 of the primary key, instead of -destDB")
+	maxRowBytes := flag.Int64("maxRowBytes", 0, "Rows whose values add up to more than this many bytes are handled per -oversizedRowPolicy (0 disables); the driver cannot stream large values, so each row being copied is held in memory whole")
+	oversizedRowPolicy := flag.String("oversizedRowPolicy", "skip", "What to do with rows over -maxRowBytes: skip (log the key and continue) or fail (stop the table)")
+	maxReplicaLag := flag.Duration("maxReplicaLag", 0, "Pause inserts while the -replicaLagHost replica lags more than this behind (0 disables)")
+	replicaLagHost := flag.String("replicaLagHost", "", "Replica whose lag throttles inserts, connected with -dbUser and -dbPassword")
+	replicaLagQuery := flag.String("replicaLagQuery", "", "Query returning the replica lag in seconds, instead of Seconds_Behind_Master from SHOW SLAVE STATUS")
+	noDefaultDB := flag.Bool("noDefaultDB", false, "Connect without a default database; every source and destination table must be qualified as database.table")
+	connCharset := flag.String("connCharset", "utf8mb4", "Character set of the source and destination connections, so multibyte text is not converted through the server default")
+	connCollation := flag.String("connCollation", "", "Collation of the source and destination connections, must belong to -connCharset (default: the driver's for the character set)")
+	chunkSize := flag.Int("chunkSize", 0, "Read the source in chunks of this many rows, each in its own short transaction, in primary key order, so every table needs one (0 reads in one query)")
+	chunkPause := flag.Duration("chunkPause", 0, "Pause between -chunkSize chunks to reduce the load on a live source")
+	maxAffectedRows := flag.Int64("maxAffectedRows", 0, "Abort a table once its inserts report more affected rows in total than this; with -onConflict replace a replaced row counts twice (0 disables)")
+	lockTables := flag.Bool("lock", false, "Hold a MySQL advisory lock on each destination table while migrating it, so concurrent runs into the same table wait or fail instead of interleaving")
+	lockName := flag.String("lockName", "cluster-sync:", "Prefix of the -lock names, followed by database.table of the destination table")
+	lockTimeout := flag.Duration("lockTimeout", 0, "How long -lock waits for another run to release a table, in whole seconds (0 fails right away)")
+	manifestPath := flag.String("manifest", "", "JSON file recording the status and row counts of every table, rewritten as tables start and finish")
+	resume := flag.Bool("resume", false, "Skip the tables -manifest lists as done; tables in progress or failed are copied again from the start")
+	destSessionVars := sessionVariables{}
+	flag.Var(destSessionVars, "destSessionVar", "Session variable set on every destination connection as 'name=value', repeatable; quote string values (e.g. -destSessionVar foreign_key_checks=0)")
+	checkPrivileges := flag.Bool("preflightPrivileges", false, "Before migrating, check SHOW GRANTS for the privileges the enabled options need and list the missing ones")
+	setColumns := columnValues{}
+	flag.Var(&setColumns, "setColumn", "Constant for a destination column missing from the source as 'column:value', repeatable (e.g. -setColumn tenant_id:42)")
+	defaultOverrides := columnValues{}
+	flag.Var(&defaultOverrides, "defaultFor", "Default clause for a created destination column instead of the source's, as 'column:expression' or 'column:NONE' for no default, repeatable (e.g. -defaultFor status:'new')")
+	completeSchema := flag.Bool("completeSchema", false, "Add the source indexes and CHECK constraints an existing destination table lacks, such as after a run interrupted while creating them; existing tables are otherwise never altered")
+	stampComment := flag.Bool("stampComment", false, "Append 'migrated by cluster-sync at <time> from <source table>' to the COMMENT of each destination table, replacing the stamp of an earlier run")
+	destCollation := flag.String("destCollation", "", "Default collation of created destination tables instead of the source table's, its character set follows from the name (e.g. utf8mb4_0900_ai_ci)")
+	columnCollations := columnValues{}
+	flag.Var(&columnCollations, "collateColumn", "Collation of a created destination column as 'column:collation', repeatable (e.g. -collateColumn email:utf8mb4_bin)")
+	typeOverrides := columnValues{}
+	flag.Var(&typeOverrides, "retype", "Type of a created destination column instead of the source's, as 'column:TYPE', repeatable (e.g. -retype notes:VARCHAR(500))")
+	ignoreCollation := flag.Bool("ignoreCollation", false, "Do not report column collation differences in -validateOnly, even incompatible ones")
+	continueFromTable := flag.String("continueFromTable", "", "Skip the tables listed before this source table, to resume a failed multi-table run")
+	excludePatterns := flag.String("excludeTables", "", "Comma-separated glob patterns of source tables to skip (e.g. '*_log,cache_*')")
+	keepaliveInterval := flag.Duration("keepaliveInterval", 0, "Ping the destination connection this often until the first source row arrives, keep below the server's wait_timeout (0 disables)")
+	onConflict := flag.String("onConflict", "error", "What to do with rows whose key already exists in the destination: error (log and skip) or replace (REPLACE INTO, which deletes the old row and resets columns not in the source to their defaults)")
+	deadLetterTable := flag.String("deadLetterTable", "", "Destination table, created if missing, that rows failing to insert are recorded in as JSON with their error, alongside the log")
+	logFailedSQL := flag.Bool("logFailedSQL", false, "Log each failing insert with its parameter values filled in, ready to rerun by hand")
+	verifySampleSize := flag.Int("verifySample", 0, "After migrating, compare this many randomly chosen source rows per table with the destination by primary key")
+	benchmarkRows := flag.Int("benchmarkRows", 10000, "Number of synthetic rows the benchmark command inserts per run")
+	benchmarkColumns := flag.String("benchmarkColumns", "int,varchar,datetime", "Comma-separated benchmark column types (int, bigint, double, decimal, varchar, text, datetime)")
+	benchmarkTxSizes := flag.String("benchmarkTransactionSizes", "", "Comma-separated -rowsPerTransaction values the benchmark command runs with (defaults to -rowsPerTransaction)")
+	destTablePrefix := flag.String("destTablePrefix", "", "Prefix added to every destination table name (e.g. copy_)")
+	destTableSuffix := flag.String("destTableSuffix", "", "Suffix added to every destination table name")
+	sourceQuery := flag.String("sourceQuery", "", "SELECT statement whose result is copied into -destTable instead of a source table")
+	preserveIds := flag.Bool("preserveIds", false, "Guarantee source auto-increment values are kept exactly, including 0")
+	where := whereFilters{}
+	flag.Var(where, "whereFor", "Per-table row filter as 'table:condition', repeatable (e.g. -whereFor 'orders:created_at > 2024-01-01')")
+	progressJSON := flag.String("progressJSON", "", "Write newline-delimited JSON progress events to this file or named pipe ('-' for stdout, which suppresses the human-readable output)")
+	encryptColumns := flag.String("encryptColumns", "", "Comma-separated columns encrypted before insert; destination columns must be VARBINARY or BLOB")
+	encryptionKeyFile := flag.String("encryptionKeyFile", "", "File holding the hex-encoded AES key used by -encryptColumns")
+	skipExisting := flag.Bool("skipExisting", false, "Skip source rows whose primary key already exists in the destination table (requires a primary key)")
+	trace := flag.Bool("trace", false, "Log every source and destination statement with its duration and affected rows, to diagnose slow introspection or inserts")
+	reportFormat := flag.String("reportFormat", "text", "Format of the final summary: text (progress output only), json (one document on stdout, progress moves to stderr) or table (aligned grid of the tables)")
+	summaryOnly := flag.Bool("summaryOnly", false, "Suppress intermediate output and print one key=value summary line per table")
+	lowPriority := flag.Bool("lowPriority", false, "Use INSERT LOW_PRIORITY so writes yield to readers on table-locking engines (MyISAM, MEMORY, MERGE)")
+	diffOutput := flag.String("diffOutput", "", "File to write the compare command's row differences to (default stdout)")
+
+	defaultsFile := flag.String("defaultsFile", "", "MySQL option file (my.cnf) to read host, user, password and port from; explicit flags take precedence")
+	defaultsGroup := flag.String("defaultsGroup", "client", "Option file group read after [client] by -defaultsFile")
+
+	flag.CommandLine.Parse(args)
+
+	// Fill in connection settings not given on the command line from the option file
+	passwordGiven := false
+	flag.Visit(func(f *flag.Flag) { passwordGiven = passwordGiven || f.Name == "dbPassword" })
+	if *defaultsFile != "" {
+		filePassword, err := applyOptionFile(*defaultsFile, *defaultsGroup, sourceDBHost, destDBHost, dbUser, dbPassword)
+		if err != nil {
+			log.Fatalf("Error reading defaults file: %v", err)
+		}
+		passwordGiven = passwordGiven || filePassword
+	}
+
+	// Without a password from either, ask for it on a terminal instead of using the default
+	if !passwordGiven {
+		hosts := []string{*sourceDBHost}
+		if *destDBHost != *sourceDBHost {
+			hosts = append(hosts, *destDBHost)
+		}
+		password, ok, err := promptPassword(*dbUser, hosts)
+		if err != nil {
+			log.Fatalf("Error reading password: %v", err)
+		}
+		if ok {
+			*dbPassword = password
+		}
+	}
+
+	isolationLevel, err := parseIsolationLevel(*sourceIsolation)
+	if err != nil {
+		log.Fatalf("Invalid -sourceIsolation: %v", err)
+	}
+
+	// Tables to migrate, either from the tables file or the single-table flags. Without
+	// -destTable the source table name is used.
+	if *destTableName == "" {
+		*destTableName = *sourceTableName
+	}
+	tables := []tablePair{{source: *sourceTableName, dest: *destTableName}}
+	if *tablesFile != "" {
+		tables, err = readTablesFile(*tablesFile)
+		if err != nil {
+			log.Fatalf("Error reading tables file: %v", err)
+		}
+	}
+
+	if *output != "" {
+		if *outputFormat != "csv" {
+			log.Fatalf("Unsupported -outputFormat '%s'", *outputFormat)
+		}
+		if len(tables) != 1 {
+			log.Fatalf("-output exports a single table, got %d", len(tables))
+		}
+		if *compress != "" && *compress != "gzip" {
+			log.Fatalf("Unsupported -compress '%s', expected gzip", *compress)
+		}
+		// Keep stdout for the exported data alone
+		if *output == "-" {
+			progress = os.Stderr
+		}
+	}
+	if *profile && (!*validateOnly || *sourceQuery != "") {
+		log.Fatalf("-profile only applies to -validateOnly of source tables, not -sourceQuery")
+	}
+	if *compress != "" && *output == "" {
+		log.Fatalf("-compress only applies to -output")
+	}
+	// A source query replaces the source table of a single destination table
+	if *sourceQuery != "" {
+		if *tablesFile != "" || *sourceTableName != "" || *destTableName == "" {
+			log.Fatalf("-sourceQuery copies into the single table named by -destTable, without -sourceTable or -tablesFile")
+		}
+		if *verifySampleSize > 0 {
+			log.Fatalf("-verifySample needs a source table and cannot be used with -sourceQuery")
+		}
+		// These read the source table itself, which a source query does not have
+		if *validateOnly || *schemaOnly || *output != "" || command == "compare" || command == "schema-diff" {
+			log.Fatalf("-sourceQuery only supports migrating, not compare, schema-diff, -validateOnly, -printSchema or -output")
+		}
+		*sourceQuery, err = validateSourceQuery(*sourceQuery)
+		if err != nil {
+			log.Fatalf("Invalid -sourceQuery: %v", err)
+		}
+		tables = []tablePair{{source: sourceQueryLabel, dest: *destTableName}}
+	}
+
+	if *excludePatterns != "" {
+		tables, err = excludeTables(tables, splitList(*excludePatterns))
+		if err != nil {
+			log.Fatalf("Invalid -excludeTables: %v", err)
+		}
+		if len(tables) == 0 {
+			log.Fatalf("-excludeTables excluded every table")
+		}
+	}
+	if *continueFromTable != "" {
+		start := -1
+		for i, table := range tables {
+			if table.source == *continueFromTable {
+				start = i
+				break
+			}
+		}
+		if start < 0 {
+			log.Fatalf("-continueFromTable '%s' is not in the list of tables to migrate", *continueFromTable)
+		}
+		if start > 0 {
+			log.Printf("Continuing from table '%s', skipping %d table(s) before it\n", *continueFromTable, start)
+		}
+		tables = tables[start:]
+	}
+	if *destTablePrefix != "" || *destTableSuffix != "" {
+		// The affixes apply to the table of a database-qualified name, not the database
+		for i := range tables {
+			database, table := splitTableName(tables[i].dest)
+			table = *destTablePrefix + table + *destTableSuffix
+			if !isPlainIdentifier(table) {
+				log.Fatalf("Destination table name '%s' is not a valid identifier", table)
+			}
+			tables[i].dest = table
+			if database != nil {
+				tables[i].dest = fmt.Sprintf("%s.%s", database, table)
+			}
+		}
+	}
+
+	// A filter for a table that is not migrated is most likely a typo
+	for table := range where {
+		found := false
+		for _, pair := range tables {
+			found = found || pair.source == table
+		}
+		if !found {
+			log.Fatalf("-whereFor names table '%s', which is not being migrated", table)
+		}
+	}
+	// Without a default database, only qualified names say where a table lives
+	if *noDefaultDB {
+		if *sourceDBName != "" || *destDBName != "" || *destShards != "" || command == "benchmark" {
+			log.Fatalf("-noDefaultDB takes database-qualified table names instead of -sourceDB, -destDB or -destShards, and cannot run the benchmark")
+		}
+		for _, pair := range tables {
+			if (*sourceQuery == "" && !strings.Contains(pair.source, ".")) || !strings.Contains(pair.dest, ".") {
+				log.Fatalf("-noDefaultDB requires database-qualified table names, got '%s' -> '%s'", pair.source, pair.dest)
+			}
+		}
+	}
+	if *resume && *manifestPath == "" {
+		log.Fatalf("-resume needs -manifest")
+	}
+	if *manifestPath != "" && (command != "" || *validateOnly || *inputCSV != "" || *output != "") {
+		log.Fatalf("-manifest only records migrations, not commands, -validateOnly, -inputCSV or -output")
+	}
+	// Staging tables are swapped in on -destDB only
+	if *destShards != "" && (command != "" || *validateOnly || *inputCSV != "" || *verifySampleSize > 0 || *validateFKs || *stagingSwap) {
+		log.Fatalf("-destShards only supports migrating, not compare, -validateOnly, -inputCSV, -verifySample, -validateForeignKeys or -stagingSwap")
+	}
+	for _, override := range defaultOverrides {
+		if strings.TrimSpace(override.value) == "" || strings.Contains(override.value, ";") {
+			log.Fatalf("-defaultFor '%s' needs a single default expression, got %q", override.column, override.value)
+		}
+		for _, column := range splitList(*autoTimestamps) {
+			if column == override.column {
+				log.Fatalf("Column '%s' is in both -autoTimestamps and -defaultFor", column)
+			}
+		}
+	}
+	for _, override := range typeOverrides {
+		if strings.TrimSpace(override.value) == "" || strings.Contains(override.value, ";") {
+			log.Fatalf("-retype '%s' needs a single column type, got %q", override.column, override.value)
+		}
+	}
+	ddl := ddlOptions{
+		autoTimestamps:   splitList(*autoTimestamps),
+		defaultOverrides: defaultOverrides,
+		typeOverrides:    typeOverrides,
+		collation:        *destCollation,
+		columnCollations: columnCollations,
+		completeSchema:   *completeSchema,
+	}
+	if *stampComment {
+		ddl.stamp = "migrated by cluster-sync at " + time.Now().UTC().Format(time.RFC3339)
+	}
+	if *onConflict != "error" && *onConflict != "replace" {
+		log.Fatalf("Unsupported -onConflict '%s', expected error or replace", *onConflict)
+	}
+	if *oversizedRowPolicy != "skip" && *oversizedRowPolicy != "fail" {
+		log.Fatalf("Unsupported -oversizedRowPolicy '%s', expected skip or fail", *oversizedRowPolicy)
+	}
+	switch *reportFormat {
+	case "text", "table":
+	case "json":
+		if *progressJSON == "-" {
+			log.Fatalf("-reportFormat json and -progressJSON - cannot both write to stdout")
+		}
+	default:
+		log.Fatalf("Unsupported -reportFormat '%s', expected text, json or table", *reportFormat)
+	}
+	if *summaryOnly && *reportFormat != "text" {
+		log.Fatalf("-summaryOnly only applies to -reportFormat text")
+	}
+	if (*maxReplicaLag > 0) != (*replicaLagHost != "") {
+		log.Fatalf("-maxReplicaLag and -replicaLagHost must be used together")
+	}
+	if *tableConcurrency < 1 {
+		log.Fatalf("-tableConcurrency must be at least 1")
+	}
+	if (*encryptColumns == "") != (*encryptionKeyFile == "") {
+		log.Fatalf("-encryptColumns and -encryptionKeyFile must be used together")
+	}
+	if *inputCSV != "" && len(tables) != 1 {
+		log.Fatalf("-inputCSV imports into a single table, got %d", len(tables))
+	}
+	// The import writes through the same inserts as a copy, but the checks made per
+	// source row are not part of it
+	if *inputCSV != "" && (*skipExisting || *nullToDefault || *maxRowBytes > 0 || *maxAffectedRows > 0 || *logWarnings || *strictWarnings || *stagingSwap || *disableKeysDuringLoad) {
+		log.Fatalf("-inputCSV cannot be combined with -skipExisting, -nullToDefault, -maxRowBytes, -maxAffectedRows, -logWarnings, -strictWarnings, -stagingSwap or -disableKeysDuringLoad")
+	}
+	if *chunkSize < 0 || (*chunkPause > 0 && *chunkSize == 0) {
+		log.Fatalf("-chunkPause needs a positive -chunkSize")
+	}
+	if *lockTables && *lockName == "" {
+		log.Fatalf("-lock needs a -lockName prefix")
+	}
+	if *chunkSize > 0 && *snapshotFile != "" {
+		log.Fatalf("-chunkSize cannot be combined with -snapshotFile")
+	}
+	// Chunks follow the primary key of a source table, and the binlog position or GTID
+	// set captured with the first chunk does not describe the later ones
+	if *chunkSize > 0 && (*sourceQuery != "" || *captureBinlogPos || *binlogPosFile != "" || *captureGTID) {
+		log.Fatalf("-chunkSize cannot be combined with -sourceQuery, -captureBinlogPos, -binlogPosFile or -captureGTID")
+	}
+	// A snapshot holds the rows of one table read with one filter
+	if *snapshotFile != "" && len(tables) != 1 {
+		log.Fatalf("-snapshotFile caches a single table, got %d", len(tables))
+	}
+
+	// Session variables applied to every pooled connection of each side
+	sourceParams := url.Values{}
+	destParams := url.Values{}
+	for _, params := range []url.Values{sourceParams, destParams} {
+		if err := setConnCharset(params, *connCharset, *connCollation); err != nil {
+			log.Fatalf("Invalid -connCollation: %v", err)
+		}
+	}
+	if *sourceTimeZone != "" {
+		sourceParams.Set("time_zone", quoteSessionValue(*sourceTimeZone))
+	}
+	if *destTimeZone != "" {
+		destParams.Set("time_zone", quoteSessionValue(*destTimeZone))
+	}
+	if *preserveIds {
+		setPreserveIds(destParams)
+	}
+	for name, values := range destSessionVars {
+		if destParams.Has(name) {
+			log.Fatalf("-destSessionVar %s conflicts with the value another option sets", name)
+		}
+		destParams[name] = values
+	}
 
-	flag.Parse()
+	// Tracing wraps the driver, so runs without it use the driver as is
+	driverName := "mysql"
+	if *trace {
+		driverName = tracingDriverName
+	}
 
 	// Source and Destination connection strings
-	sourceDSN := fmt.Sprintf("%s:%s@tcp(%s)/%s", *dbUser, *dbPassword, *sourceDBHost, *sourceDBName)
-	destDSN := fmt.Sprintf("%s:%s@tcp(%s)/%s", *dbUser, *dbPassword, *destDBHost, *destDBName)
+	sourceDSN := buildDSN(*dbUser, *dbPassword, *sourceDBHost, *sourceDBName, sourceParams)
+	destDSN := buildDSN(*dbUser, *dbPassword, *destDBHost, *destDBName, destParams)
 
 	// Connect to source database
-	srcDB, err := sql.Open("mysql", sourceDSN)
+	srcDB, err := sql.Open(driverName, sourceDSN)
 	if err != nil {
 		log.Fatalf("Error connecting to source database: %v", err)
 	}
 	defer srcDB.Close()
+	// CSV imports and the benchmark never read from the source
+	if *inputCSV == "" && command != "benchmark" {
+		if err = pingWithRetry(srcDB, "source", *connectRetries, *connectRetryInterval); err != nil {
+			log.Fatalf("Error connecting to source database: %v", err)
+		}
+	}
+
+	// Schema printing only reads from the source
+	if *schemaOnly {
+		if err = printSchema(srcDB, tables, ddl); err != nil {
+			log.Fatalf("Error printing schema: %v", err)
+		}
+		return
+	}
+
+	// Export mode only reads from the source
+	if *output != "" {
+		err = exportCSV(context.Background(), srcDB, tables[0].source, where[tables[0].source], *output, *compress, *csvNull, isolationLevel)
+		if err != nil {
+			log.Fatalf("Error exporting table: %v", err)
+		}
+		return
+	}
 
 	// Connect to destination database
-	dstDB, err := sql.Open("mysql", destDSN)
+	dstDB, err := sql.Open(driverName, destDSN)
 	if err != nil {
 		log.Fatalf("Error connecting to destination database: %v", err)
 	}
 	defer dstDB.Close()
+	if err = pingWithRetry(dstDB, "destination", *connectRetries, *connectRetryInterval); err != nil {
+		log.Fatalf("Error connecting to destination database: %v", err)
+	}
+
+	// Created tables must use collations the destination knows
+	if err = checkCollations(dstDB, ddl); err != nil {
+		log.Fatalf("Error checking collations: %v", err)
+	}
+
+	// The healthcheck command only checks that both databases are reachable, exiting
+	// non-zero through the failed pings above otherwise
+	if command == "healthcheck" {
+		fmt.Println("Source and destination databases are reachable")
+		return
+	}
+
+	// The benchmark command measures destination insert throughput with synthetic rows
+	if command == "benchmark" {
+		txSizes := []int{*rowsPerTransaction}
+		if *benchmarkTxSizes != "" {
+			txSizes = nil
+			for _, value := range splitList(*benchmarkTxSizes) {
+				txSize, err := strconv.Atoi(value)
+				if err != nil || txSize < 0 {
+					log.Fatalf("Invalid -benchmarkTransactionSizes value '%s'", value)
+				}
+				txSizes = append(txSizes, txSize)
+			}
+		}
+		err = runBenchmark(context.Background(), dstDB, splitList(*benchmarkColumns), *benchmarkRows, txSizes, migrationOptions{destInitSQL: destInitSQL, destFinalizeSQL: destFinalizeSQL})
+		if err != nil {
+			log.Fatalf("Error running benchmark: %v", err)
+		}
+		return
+	}
+
+	// Sharded migrations write to one database per shard on the destination server
+	shardNames := splitList(*destShards)
+	var shards []destShard
+	for _, shardName := range shardNames {
+		shardDB, err := sql.Open(driverName, buildDSN(*dbUser, *dbPassword, *destDBHost, shardName, destParams))
+		if err != nil {
+			log.Fatalf("Error connecting to shard database '%s': %v", shardName, err)
+		}
+		defer shardDB.Close()
+		if err = pingWithRetry(shardDB, "shard "+shardName, *connectRetries, *connectRetryInterval); err != nil {
+			log.Fatalf("Error connecting to shard database '%s': %v", shardName, err)
+		}
+		shards = append(shards, destShard{name: shardName, db: shardDB})
+	}
+
+	// The schema-diff command reports structural differences instead of migrating
+	if command == "schema-diff" {
+		identical, err := schemaDiff(srcDB, dstDB, tables)
+		if err != nil {
+			log.Fatalf("Error comparing schemas: %v", err)
+		}
+		if !identical {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// The compare command reports differing rows instead of migrating
+	if command == "compare" {
+		out := os.Stdout
+		if *diffOutput != "" {
+			out, err = os.Create(*diffOutput)
+			if err != nil {
+				log.Fatalf("Error creating diff output: %v", err)
+			}
+			defer out.Close()
+		}
+		identical, err := compareTables(context.Background(), srcDB, dstDB, tables, out)
+		if err != nil {
+			log.Fatalf("Error comparing tables: %v", err)
+		}
+		if !identical {
+			out.Close()
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Validation mode checks every table without copying or creating anything
+	if *validateOnly {
+		passed := validateTables(srcDB, dstDB, tables, ddl, setColumns, *ignoreCollation)
+		if *profile {
+			for _, table := range tables {
+				if err := profileTable(srcDB, table.source, where[table.source]); err != nil {
+					log.Fatalf("Error profiling table '%s': %v", table.source, err)
+				}
+			}
+		}
+		if !passed {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Column options naming the wrong columns would otherwise be ignored or fail each
+	// table. A CSV import checks its own columns.
+	if *inputCSV == "" {
+		sources := make([]string, len(tables))
+		for i, table := range tables {
+			sources[i] = table.source
+			if *sourceQuery != "" {
+				sources[i] = sourceQueryFrom(*sourceQuery)
+			}
+		}
+		problems, err := checkColumnOptions(srcDB, sources, typeOverrides, setColumns)
+		if err != nil {
+			log.Fatalf("Error checking column options: %v", err)
+		}
+		if len(problems) > 0 {
+			log.Fatalf("Invalid column options: %s", strings.Join(problems, "; "))
+		}
+	}
+
+	opts := migrationOptions{
+		ddl:                ddl,
+		isolation:          isolationLevel,
+		slowRowThreshold:   *slowRowThreshold,
+		heartbeat:          *heartbeat,
+		nullToDefault:      *nullToDefault,
+		rowsPerTransaction: *rowsPerTransaction,
+		logWarnings:        *logWarnings,
+		strictWarnings:     *strictWarnings,
+		stagingSwap:        *stagingSwap,
+		lowPriority:        *lowPriority,
+		summaryOnly:        *summaryOnly,
+		reportFormat:       *reportFormat,
+		skipExisting:       *skipExisting,
+		encryptColumns:     splitList(*encryptColumns),
+		where:              where,
+		sourceQuery:        *sourceQuery,
+		logFailedSQL:       *logFailedSQL,
+		deadLetterTable:    *deadLetterTable,
+		onConflict:         *onConflict,
+		keepaliveInterval:  *keepaliveInterval,
+		setColumns:         setColumns,
+		destInitSQL:        destInitSQL,
+		destFinalizeSQL:    destFinalizeSQL,
+		disableKeys:        *disableKeysDuringLoad,
+		snapshotFile:       *snapshotFile,
+		refreshSnapshot:    *refreshSnapshot,
+		maxRowBytes:        *maxRowBytes,
+		oversizedRowPolicy: *oversizedRowPolicy,
+		chunkSize:          *chunkSize,
+		maxAffectedRows:    *maxAffectedRows,
+		chunkPause:         *chunkPause,
+		shards:             shards,
+	}
+	if *lockTables {
+		opts.lockName, opts.lockTimeout = *lockName, *lockTimeout
+	}
+	switch *progressJSON {
+	case "":
+	case "-":
+		progress = io.Discard
+		opts.progressEvents = newProgressEmitter(os.Stdout)
+	default:
+		eventsFile, err := os.Create(*progressJSON)
+		if err != nil {
+			log.Fatalf("Error opening progress events file: %v", err)
+		}
+		defer eventsFile.Close()
+		opts.progressEvents = newProgressEmitter(eventsFile)
+	}
+	if *encryptionKeyFile != "" {
+		opts.encryptor, err = newAESGCMEncryptor(*encryptionKeyFile)
+		if err != nil {
+			log.Fatalf("Error loading encryption key: %v", err)
+		}
+	}
+	if *summaryOnly {
+		progress = io.Discard
+	}
+	// Keep stdout for the JSON report alone
+	if *reportFormat == "json" {
+		progress = os.Stderr
+	}
+	// Ctrl-C or SIGTERM stops the copy at the next row and rolls back the open batch
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Import mode reads from the CSV file instead of the source
+	if *inputCSV != "" {
+		err = importCSV(ctx, dstDB, tables[0].dest, *inputCSV, *csvNull, opts)
+		if err != nil {
+			log.Fatalf("Error importing CSV: %v", err)
+		}
+		return
+	}
 
-	// Check if the destination table exists, and create it if not
-	err = createTableIfNotExists(srcDB, dstDB, *sourceTableName, *destTableName)
+	// -binlogPosFile alone captures file and position, as before -captureGTID existed
+	opts.captureBinlogPos = *captureBinlogPos || (*binlogPosFile != "" && !*captureGTID)
+	opts.captureGTID = *captureGTID
+	if opts.captureBinlogPos || opts.captureGTID {
+		opts.binlogPositions = &binlogPositions{}
+	}
+	// The manifest records the state of every table; resuming skips those already done
+	if *manifestPath != "" {
+		var previous *migrationManifest
+		if *resume {
+			previous, err = readManifest(*manifestPath)
+			if err != nil {
+				log.Fatalf("Error reading manifest: %v", err)
+			}
+		}
+		opts.manifest = newManifest(*manifestPath, tables, previous)
+		if err = opts.manifest.write(); err != nil {
+			log.Fatalf("Error writing manifest: %v", err)
+		}
+
+		var remaining []tablePair
+		for _, table := range tables {
+			entry, _ := opts.manifest.find(table)
+			prior, _ := previous.find(table)
+			switch {
+			case entry.Status == manifestDone:
+				log.Printf("Skipping table '%s', done according to the manifest\n", table.source)
+				continue
+			case (prior.Status == manifestInProgress || prior.Status == manifestFailed) && !*skipExisting && *onConflict != "replace":
+				log.Printf("Warning: table '%s' was %s and is copied again from the start, use -skipExisting or -onConflict replace to avoid duplicate key failures\n", table.source, prior.Status)
+			}
+			remaining = append(remaining, table)
+		}
+		tables = remaining
+	}
+	// Report missing privileges upfront instead of failing partway through
+	if *checkPrivileges {
+		destNames := []string{*destDBName}
+		if len(shardNames) > 0 {
+			destNames = shardNames
+		}
+		readsDest := *skipExisting || *verifySampleSize > 0 || *validateFKs
+		var sourceChecks, destChecks []privilegeCheck
+		for _, destName := range destNames {
+			source, dest := migrationPrivilegeChecks(*sourceDBName, destName, tables, opts, opts.captureBinlogPos, readsDest)
+			sourceChecks = source
+			destChecks = append(destChecks, dest...)
+		}
+		passed, err := preflightPrivileges(srcDB, dstDB, sourceChecks, destChecks)
+		if err != nil {
+			log.Fatalf("Error checking privileges: %v", err)
+		}
+		if !passed {
+			log.Fatalf("Privilege preflight failed, grant the missing privileges and rerun")
+		}
+		progressf("Privilege preflight passed\n")
+	}
+	if *replicaLagHost != "" {
+		replicaDB, err := sql.Open("mysql", buildDSN(*dbUser, *dbPassword, *replicaLagHost, "", nil))
+		if err != nil {
+			log.Fatalf("Error connecting to replica: %v", err)
+		}
+		defer replicaDB.Close()
+		if err = pingWithRetry(replicaDB, "replica", *connectRetries, *connectRetryInterval); err != nil {
+			log.Fatalf("Error connecting to replica: %v", err)
+		}
+		throttle, stopMonitor := startReplicaLagMonitor(ctx, replicaDB, *replicaLagQuery, *maxReplicaLag)
+		defer stopMonitor()
+		opts.replicaLag = throttle
+	}
+	_, err = migrateTables(ctx, srcDB, dstDB, tables, *tableConcurrency, *stopOnError, opts)
+	if *binlogPosFile != "" {
+		if err := opts.binlogPositions.writeFile(*binlogPosFile); err != nil {
+			log.Printf("Error writing binlog positions: %v\n", err)
+		}
+	}
 	if err != nil {
-		log.Fatalf("Error creating table: %v", err)
+		log.Fatalf("Migration failed: %v", err)
+	}
+
+	// Spot-check a random sample of rows, far cheaper than the compare command
+	if *verifySampleSize > 0 {
+		matched, err := verifySample(ctx, srcDB, dstDB, tables, *verifySampleSize, opts)
+		if err != nil {
+			log.Fatalf("Error verifying sample: %v", err)
+		}
+		if !matched {
+			log.Fatalf("Sample verification failed: mismatched rows found")
+		}
+	}
+
+	// Check referential integrity of the copied data
+	if *validateFKs {
+		valid, err := validateForeignKeys(dstDB, tables)
+		if err != nil {
+			log.Fatalf("Error validating foreign keys: %v", err)
+		}
+		if !valid {
+			log.Fatalf("Foreign key validation failed: orphaned rows found")
+		}
+	}
+}
+
+// parseIsolationLevel maps a -sourceIsolation value to its database/sql isolation level
+func parseIsolationLevel(name string) (sql.IsolationLevel, error) {
+	switch name {
+	case "":
+		return sql.LevelDefault, nil
+	case "read-committed":
+		return sql.LevelReadCommitted, nil
+	case "repeatable-read":
+		return sql.LevelRepeatableRead, nil
+	case "serializable":
+		return sql.LevelSerializable, nil
+	}
+	return sql.LevelDefault, fmt.Errorf("unknown isolation level '%s'", name)
+}
+
+// isPlainIdentifier reports whether name is a MySQL identifier that needs no quoting
+func isPlainIdentifier(name string) bool {
+	if name == "" || len(name) > 64 {
+		return false
 	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '$') {
+			return false
+		}
+	}
+	return true
+}
 
-	// Perform data migration
-	migrateData(srcDB, dstDB, *sourceTableName, *destTableName)
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
 
-// createTableIfNotExists dynamically copies table schema from source to destination
-func createTableIfNotExists(srcDB, destDB *sql.DB, sourceTableName, destTableName string) error {
+// createTableIfNotExists dynamically copies table schema from source to destination,
+// reporting whether the table had to be created
+func createTableIfNotExists(srcDB, destDB *sql.DB, sourceTableName, destTableName string, ddl ddlOptions) (bool, error) {
 	// Check if table exists in the destination
 	var tableName string
-	checkQuery := fmt.Sprintf("SELECT table_name FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = '%s'", destTableName)
-	err := destDB.QueryRow(checkQuery).Scan(&tableName)
+	schema, table := splitTableName(destTableName)
+	checkQuery := "SELECT table_name FROM information_schema.tables WHERE table_schema = COALESCE(?, DATABASE()) AND table_name = ?"
+	err := destDB.QueryRow(checkQuery, schema, table).Scan(&tableName)
 
 	if err == sql.ErrNoRows {
+		// Detect both servers so the DDL can be adjusted between MySQL and MariaDB
+		srcServer, err := detectServer(srcDB)
+		if err != nil {
+			return false, err
+		}
+		destServer, err := detectServer(destDB)
+		if err != nil {
+			return false, err
+		}
+		progressf("Source server: %s, destination server: %s\n", srcServer, destServer)
+
 		// If the table doesn't exist, retrieve the source table's structure
-		tableDef, err := getTableDefinition(srcDB, sourceTableName)
+		createTableSQL, err := buildCreateTableSQL(srcDB, sourceTableName, destTableName, ddl, destServer)
 		if err != nil {
-			return fmt.Errorf("failed to get table definition: %v", err)
+			return false, err
 		}
 
 		// Create the table in the destination
-		createTableSQL := fmt.Sprintf("CREATE TABLE %s (%s)", destTableName, tableDef)
 		_, err = destDB.Exec(createTableSQL)
 		if err != nil {
-			return fmt.Errorf("failed to create table: %v", err)
+			return false, fmt.Errorf("failed to create table: %v\ngenerated statement: %s", err, createTableSQL)
 		}
-		fmt.Printf("Table '%s' created successfully\n", destTableName)
-		return nil
+		progressf("Table '%s' created successfully\n", destTableName)
+		return true, nil
 	} else if err != nil {
-		return fmt.Errorf("error checking table existence: %v", err)
+		return false, fmt.Errorf("error checking table existence: %v", err)
+	}
+
+	// Table already exists, complete it with -completeSchema if an earlier run left
+	// indexes or constraints missing
+	progressf("Table '%s' already exists\n", destTableName)
+	if ddl.completeSchema {
+		if err := completeTable(srcDB, destDB, sourceTableName, destTableName); err != nil {
+			return false, err
+		}
+	}
+	if ddl.stamp != "" {
+		if err := stampTableComment(destDB, destTableName, sourceTableName, ddl.stamp); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// buildCreateTableSQL generates the CREATE TABLE statement reproducing the source table
+// as destTableName on the destination server
+func buildCreateTableSQL(srcDB *sql.DB, sourceTableName, destTableName string, ddl ddlOptions, destServer serverInfo) (string, error) {
+	tableDef, err := getTableDefinition(srcDB, sourceTableName, ddl, destServer)
+	if err != nil {
+		return "", fmt.Errorf("failed to get table definition: %v", err)
+	}
+	tableOptions, err := getTableOptions(srcDB, sourceTableName, ddl, destServer)
+	if err != nil {
+		return "", fmt.Errorf("failed to get table options: %v", err)
+	}
+	return fmt.Sprintf("CREATE TABLE %s (%s)%s", destTableName, tableDef, tableOptions), nil
+}
+
+// printSchema prints the CREATE TABLE statement generated for each table without
+// connecting to the destination
+func printSchema(srcDB *sql.DB, tables []tablePair, ddl ddlOptions) error {
+	srcServer, err := detectServer(srcDB)
+	if err != nil {
+		return err
 	}
 
-	// Table already exists
-	fmt.Printf("Table '%s' already exists\n", destTableName)
+	for _, table := range tables {
+		destTable := table.dest
+		if destTable == "" {
+			destTable = table.source
+		}
+		createTableSQL, err := buildCreateTableSQL(srcDB, table.source, destTable, ddl, srcServer)
+		if err != nil {
+			return fmt.Errorf("table '%s': %v", table.source, err)
+		}
+		fmt.Printf("%s;\n", createTableSQL)
+	}
 	return nil
 }
 
+// defaultNone as a -defaultFor expression creates the column without a default
+const defaultNone = "NONE"
 
-// getTableDefinition retrieves the table definition from the source DB using DESCRIBE
-func getTableDefinition(db *sql.DB, tableName string) (string, error) {
+// getTableDefinition retrieves the table definition from the source DB using DESCRIBE.
+// The columns are adjusted as ddl asks.
+func getTableDefinition(db *sql.DB, tableName string, ddl ddlOptions, destServer serverInfo) (string, error) {
 	query := fmt.Sprintf("DESCRIBE %s", tableName)
 
+	srids, err := getColumnSRIDs(db, tableName)
+	if err != nil {
+		return "", err
+	}
+	columnInfos, err := getColumns(db, tableName)
+	if err != nil {
+		return "", err
+	}
+	comments := make(map[string]string, len(columnInfos))
+	for _, column := range columnInfos {
+		comments[column.name] = column.comment
+	}
+
+	autoTimestampColumns := make(map[string]bool)
+	for _, column := range ddl.autoTimestamps {
+		autoTimestampColumns[column] = true
+	}
+	defaults := make(map[string]string, len(ddl.defaultOverrides))
+	for _, override := range ddl.defaultOverrides {
+		defaults[override.column] = override.value
+	}
+	types := make(map[string]string, len(ddl.typeOverrides))
+	for _, override := range ddl.typeOverrides {
+		types[override.column] = override.value
+	}
+	collations := make(map[string]string, len(ddl.columnCollations))
+	for _, override := range ddl.columnCollations {
+		collations[override.column] = override.value
+	}
+
 	rows, err := db.Query(query)
 	if err != nil {
 		return "", fmt.Errorf("failed to query table definition: %v", err)
@@ -104,15 +933,20 @@ func getTableDefinition(db *sql.DB, tableName string) (string, error) {
 		if err != nil {
 			return "", fmt.Errorf("failed to scan table definition: %v", err)
 		}
+		if override, ok := types[field]; ok {
+			fieldType = override
+		}
 
-		// Handle created_at and updated_at columns separately
-		if field == "created_at" || field == "updated_at" {
-			// Handle timestamps specially to avoid MySQL syntax issues
-			columnDef := fmt.Sprintf("`%s` %s", field, fieldType)
-			if field == "created_at" {
-				columnDef += " DEFAULT CURRENT_TIMESTAMP"
-			} else if field == "updated_at" {
-				columnDef += " DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP"
+		// MySQL 8 marks expression defaults as DEFAULT_GENERATED, which is not valid DDL
+		generatedDefault := strings.Contains(extra, "DEFAULT_GENERATED")
+		extra = strings.TrimSpace(strings.Replace(extra, "DEFAULT_GENERATED", "", 1))
+		extra = normalizeCurrentTimestamp(extra)
+
+		// Handle opted-in timestamp columns separately
+		if autoTimestampColumns[field] {
+			columnDef := fmt.Sprintf("`%s` %s DEFAULT CURRENT_TIMESTAMP", field, fieldType)
+			if strings.Contains(strings.ToLower(extra), "on update") {
+				columnDef += " ON UPDATE CURRENT_TIMESTAMP"
 			}
 			columns = append(columns, columnDef)
 			continue
@@ -120,6 +954,9 @@ func getTableDefinition(db *sql.DB, tableName string) (string, error) {
 
 		// Build column definition
 		columnDef := fmt.Sprintf("`%s` %s", field, fieldType)
+		if collation, ok := collations[field]; ok {
+			columnDef += fmt.Sprintf(" CHARACTER SET %s COLLATE %s", collationCharset(collation), collation)
+		}
 
 		// Handle nullability
 		if null == "NO" {
@@ -128,9 +965,26 @@ func getTableDefinition(db *sql.DB, tableName string) (string, error) {
 			columnDef += " NULL"
 		}
 
-		// Handle default values if present and valid
-		if defaultValue.Valid {
-			columnDef += fmt.Sprintf(" DEFAULT '%s'", defaultValue.String)
+		// Restrict spatial columns to the source SRID
+		if srid, ok := srids[field]; ok {
+			if destServer.mariaDB {
+				columnDef += fmt.Sprintf(" REF_SYSTEM_ID=%d", srid)
+			} else {
+				columnDef += fmt.Sprintf(" SRID %d", srid)
+			}
+		}
+
+		// Handle default values if present and valid, unless overridden
+		if override, ok := defaults[field]; ok {
+			if override != defaultNone {
+				columnDef += " DEFAULT " + override
+			}
+		} else if defaultValue.Valid {
+			defaultClause, exact := formatDefault(fieldType, defaultValue.String, generatedDefault)
+			if !exact {
+				log.Printf("Warning: default %q of column '%s' (%s) may not be reproduced exactly, review the generated DDL", defaultValue.String, field, fieldType)
+			}
+			columnDef += " DEFAULT " + defaultClause
 		}
 
 		// Handle extra information (e.g., auto_increment)
@@ -138,6 +992,10 @@ func getTableDefinition(db *sql.DB, tableName string) (string, error) {
 			columnDef += " " + extra
 		}
 
+		if comment := comments[field]; comment != "" {
+			columnDef += " COMMENT " + quoteLiteral(comment)
+		}
+
 		// Check if this column is part of the primary key
 		if key == "PRI" {
 			primaryKeyColumns = append(primaryKeyColumns, fmt.Sprintf("`%s`", field))
@@ -155,86 +1013,1054 @@ func getTableDefinition(db *sql.DB, tableName string) (string, error) {
 		tableDef += primaryKeyDef
 	}
 
+	// Add the secondary, FULLTEXT and SPATIAL indexes
+	indexes, err := getIndexes(db, tableName)
+	if err != nil {
+		return "", err
+	}
+	for _, index := range indexes {
+		tableDef += ", " + indexDefinition(index)
+	}
+
+	// Add the CHECK constraints
+	checks, err := getCheckConstraints(db, tableName)
+	if err != nil {
+		return "", err
+	}
+	for _, definition := range checkDefinitions(checks, tableName, destServer) {
+		tableDef += ", " + definition
+	}
+
 	return tableDef, nil
 }
 
+// getColumnSRIDs returns the SRID restriction of each spatial column that has one.
+// Servers without information_schema.columns.SRS_ID (MySQL 5.7, MariaDB) yield none.
+func getColumnSRIDs(db *sql.DB, tableName string) (map[string]int, error) {
+	srids := make(map[string]int)
+	query := "SELECT column_name, srs_id FROM information_schema.columns WHERE table_schema = COALESCE(?, DATABASE()) AND table_name = ? AND srs_id IS NOT NULL"
+	schema, table := splitTableName(tableName)
+	rows, err := db.Query(query, schema, table)
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == errBadFieldError {
+			return srids, nil
+		}
+		return nil, fmt.Errorf("failed to query column SRIDs: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var column string
+		var srid int
+		if err := rows.Scan(&column, &srid); err != nil {
+			return nil, fmt.Errorf("failed to scan column SRID: %v", err)
+		}
+		srids[column] = srid
+	}
+	return srids, rows.Err()
+}
+
+// quoteLiteral quotes a string as an SQL literal, escaping quotes and backslashes
+func quoteLiteral(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// formatDefault renders a DESCRIBE default value as a DDL literal for the given column type.
+// Numeric and boolean defaults are emitted unquoted; exact is false when the value had to be
+// coerced into a string literal and may not mean the same thing on the destination.
+func formatDefault(fieldType, value string, generated bool) (clause string, exact bool) {
+	if isCurrentTimestamp(value) {
+		return normalizeCurrentTimestamp(value), true
+	}
+	if generated {
+		// Expression defaults must be parenthesized in DDL
+		return fmt.Sprintf("(%s)", value), true
+	}
+
+	quoted := quoteLiteral(value)
+	baseType := strings.ToLower(fieldType)
+	if i := strings.IndexAny(baseType, "( "); i >= 0 {
+		baseType = baseType[:i]
+	}
+
+	switch baseType {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint",
+		"decimal", "numeric", "float", "double", "real", "bool", "boolean":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return quoted, false
+		}
+		return value, true
+	case "bit":
+		if strings.HasPrefix(value, "b'") {
+			return value, true
+		}
+		return quoted, false
+	}
+	return quoted, true
+}
+
+// getColumnTypes returns the column types of a table keyed by column name
+func getColumnTypes(db *sql.DB, tableName string) (map[string]*sql.ColumnType, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s LIMIT 0", tableName))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	types := make(map[string]*sql.ColumnType, len(columnTypes))
+	for _, columnType := range columnTypes {
+		types[columnType.Name()] = columnType
+	}
+	return types, nil
+}
+
+// querySourceTable selects every row of the source table, or those matching where if
+// set, inside a read-only transaction at the given isolation level. beforeQuery, if
+// set, runs in the transaction just before the rows are selected. The caller must
+// close both the rows and the transaction.
+func querySourceTable(ctx context.Context, srcDB *sql.DB, sourceTable, where string, isolation sql.IsolationLevel, beforeQuery func(*sql.Tx) error) (*sql.Tx, *sql.Rows, error) {
+	query := fmt.Sprintf("SELECT * FROM %s%s", sourceTable, whereClause(where))
+	return querySource(ctx, srcDB, query, nil, isolation, beforeQuery)
+}
+
+// querySource runs a source query like querySourceTable does
+func querySource(ctx context.Context, srcDB *sql.DB, query string, args []interface{}, isolation sql.IsolationLevel, beforeQuery func(*sql.Tx) error) (*sql.Tx, *sql.Rows, error) {
+	tx, err := srcDB.BeginTx(ctx, &sql.TxOptions{Isolation: isolation, ReadOnly: true})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to start source transaction: %v", err)
+	}
+	if beforeQuery != nil {
+		if err := beforeQuery(tx); err != nil {
+			tx.Rollback()
+			return nil, nil, err
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		tx.Rollback()
+		return nil, nil, err
+	}
+	return tx, rows, nil
+}
+
+// scanRow scans the current row into a new slice of values, converting []byte to
+// string except for spatial columns, whose binary value must be kept intact
+func scanRow(rows *sql.Rows, typeNames []string) ([]interface{}, error) {
+	return newRowScanner(typeNames).scan(rows)
+}
+
+// rowScanner scans rows like scanRow, but into one values slice and one slice of
+// pointers to it that are reused for every row, so copying a table does not allocate
+// them per row. The values of a scan are only valid until the next one.
+type rowScanner struct {
+	typeNames     []string
+	values        []interface{}
+	valuePointers []interface{}
+}
+
+func newRowScanner(typeNames []string) *rowScanner {
+	s := &rowScanner{
+		typeNames:     typeNames,
+		values:        make([]interface{}, len(typeNames)),
+		valuePointers: make([]interface{}, len(typeNames)),
+	}
+	for i := range s.values {
+		s.valuePointers[i] = &s.values[i]
+	}
+	return s
+}
+
+// scan scans the current row into the scanner's values
+func (s *rowScanner) scan(rows *sql.Rows) ([]interface{}, error) {
+	if err := rows.Scan(s.valuePointers...); err != nil {
+		return nil, err
+	}
+
+	// Convert []byte to string where necessary
+	for i, val := range s.values {
+		if b, ok := val.([]byte); ok && s.typeNames[i] != "GEOMETRY" {
+			s.values[i] = string(b)
+		}
+	}
+	return s.values, nil
+}
+
+// getPrimaryKeyColumns returns the primary key columns of a table in key order
+func getPrimaryKeyColumns(db *sql.DB, tableName string) ([]string, error) {
+	query := "SELECT column_name FROM information_schema.statistics WHERE table_schema = COALESCE(?, DATABASE()) AND table_name = ? AND index_name = 'PRIMARY' ORDER BY seq_in_index"
+	schema, table := splitTableName(tableName)
+	rows, err := db.Query(query, schema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
+
+// columnIndexes returns the positions of the named columns within cols
+func columnIndexes(cols, names []string) []int {
+	var indexes []int
+	for _, name := range names {
+		for i, col := range cols {
+			if col == name {
+				indexes = append(indexes, i)
+				break
+			}
+		}
+	}
+	return indexes
+}
+
+// describeKey formats the key column values of a row for log messages
+func describeKey(cols []string, values []interface{}, keyIndexes []int) string {
+	if len(keyIndexes) == 0 {
+		return "no primary key"
+	}
+	parts := make([]string, len(keyIndexes))
+	for i, index := range keyIndexes {
+		parts[i] = fmt.Sprintf("%s=%v", cols[index], values[index])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// rowSize estimates the bytes a row takes on the wire: the length of text and binary
+// values and 8 bytes for anything else
+func rowSize(values []interface{}) int64 {
+	var size int64
+	for _, val := range values {
+		switch v := val.(type) {
+		case nil:
+		case string:
+			size += int64(len(v))
+		case []byte:
+			size += int64(len(v))
+		default:
+			size += 8
+		}
+	}
+	return size
+}
+
+// retypedLengthPattern matches the length-limited string types -retype may narrow to
+var retypedLengthPattern = regexp.MustCompile(`(?i)^(?:var)?(char|binary)\s*\(\s*(\d+)\s*\)`)
+
+// lengthLimit is the maximum length of a retyped CHAR, VARCHAR, BINARY or VARBINARY
+// column, in characters or, for the binary types, bytes
+type lengthLimit struct {
+	columnType string
+	length     int
+	bytes      bool
+}
+
+func (l lengthLimit) valueLength(val interface{}) int {
+	switch v := val.(type) {
+	case string:
+		if l.bytes {
+			return len(v)
+		}
+		return utf8.RuneCountInString(v)
+	case []byte:
+		if l.bytes {
+			return len(v)
+		}
+		return utf8.RuneCount(v)
+	}
+	return 0
+}
+
+func (l lengthLimit) unit() string {
+	if l.bytes {
+		return "bytes"
+	}
+	return "characters"
+}
+
+// retypedLengthLimits returns the length limits of the source columns retyped to a
+// length-limited string type, by column index
+func retypedLengthLimits(cols []string, typeOverrides columnValues) map[int]lengthLimit {
+	limits := make(map[int]lengthLimit)
+	for _, override := range typeOverrides {
+		match := retypedLengthPattern.FindStringSubmatch(override.value)
+		if match == nil {
+			continue
+		}
+		length, err := strconv.Atoi(match[2])
+		if err != nil {
+			continue
+		}
+		for i, col := range cols {
+			if col == override.column {
+				limits[i] = lengthLimit{columnType: override.value, length: length, bytes: strings.EqualFold(match[1], "binary")}
+			}
+		}
+	}
+	return limits
+}
 
-
-// migrateData copies data from source table to destination table
-func migrateData(srcDB, dstDB *sql.DB, sourceTable, destTable string) {
-    // Log the start of data migration
-    fmt.Printf("Starting data migration from '%s' to '%s'\n", sourceTable, destTable)
-
-    // Prepare data extraction from source table
-    query := fmt.Sprintf("SELECT * FROM %s", sourceTable)
-    rows, err := srcDB.Query(query)
-    if err != nil {
-        log.Fatalf("Error fetching data from source table: %v", err)
-    }
-    defer rows.Close()
-    fmt.Println("Data fetched from source table successfully.")
-
-    // Dynamically determine the number of columns
-    cols, err := rows.Columns()
-    if err != nil {
-        log.Fatalf("Error fetching column information: %v", err)
-    }
-    fmt.Printf("Columns in source table: %v\n", cols)
-
-    // Prepare insert statement for the destination table
-    insertStmt := fmt.Sprintf("INSERT INTO %s VALUES (%s)", destTable, strings.Repeat("?,", len(cols)-1)+"?")
-    fmt.Printf("Insert Statement: %s\n", insertStmt)
-    stmt, err := dstDB.Prepare(insertStmt)
-    if err != nil {
-        log.Fatalf("Error preparing insert statement: %v", err)
-    }
-    defer stmt.Close()
-    fmt.Println("Insert statement prepared successfully.")
-
-    // Iterate over rows from the source table
-    rowCount := 0
-    for rows.Next() {
-        // Dynamically create a slice of interfaces to hold the values
-        values := make([]interface{}, len(cols))
-        valuePointers := make([]interface{}, len(cols))
-        for i := range values {
-            valuePointers[i] = &values[i]
-        }
-
-        // Scan the row into the values slice
-        err := rows.Scan(valuePointers...)
-        if err != nil {
-            log.Fatalf("Error scanning row: %v", err)
-        }
-
-        // Convert []byte to string where necessary
-        for i, val := range values {
-            if b, ok := val.([]byte); ok {
-                values[i] = string(b) // Convert []byte to string
-            }
-        }
-
-        // Print the row data for debugging purposes
-        rowData := make([]string, len(cols))
-        for i, col := range cols {
-            rowData[i] = fmt.Sprintf("%s: %v", col, values[i])
-        }
-        fmt.Printf("Row %d: %v\n", rowCount+1, strings.Join(rowData, ", "))
-
-        // Execute the insert statement
-        _, err = stmt.Exec(values...)
-        if err != nil {
-            log.Printf("Error inserting row %d: %v\n", rowCount+1, err)
-            continue
-        }
-
-        rowCount++
-        fmt.Printf("Successfully inserted row %d\n", rowCount)
-    }
-
-    if err = rows.Err(); err != nil {
-        log.Fatalf("Error iterating over rows: %v", err)
-    }
-
-    fmt.Printf("Data migration completed successfully. Total rows migrated: %d\n", rowCount)
+// rowKey joins the key column values of a row into a map key. Values are formatted
+// so integers scanned as int64 and as text produce the same key.
+func rowKey(values []interface{}, keyIndexes []int) string {
+	parts := make([]string, len(keyIndexes))
+	for i, index := range keyIndexes {
+		parts[i] = fmt.Sprint(values[index])
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// getExistingKeys loads the primary keys already present in a table as rowKey keys
+func getExistingKeys(ctx context.Context, db *sql.DB, tableName string, keyColumns []string) (map[string]bool, error) {
+	quoted := make([]string, len(keyColumns))
+	for i, col := range keyColumns {
+		quoted[i] = fmt.Sprintf("`%s`", col)
+	}
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM %s", strings.Join(quoted, ", "), tableName))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keyIndexes := make([]int, len(keyColumns))
+	for i := range keyIndexes {
+		keyIndexes[i] = i
+	}
+	keys := make(map[string]bool)
+	for rows.Next() {
+		values := make([]interface{}, len(keyColumns))
+		scanArgs := make([]interface{}, len(keyColumns))
+		for i := range values {
+			scanArgs[i] = &values[i]
+		}
+		if err := rows.Scan(scanArgs...); err != nil {
+			return nil, err
+		}
+		for i, val := range values {
+			if b, ok := val.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		keys[rowKey(values, keyIndexes)] = true
+	}
+	return keys, rows.Err()
+}
+
+// columnTypeNames returns the database type name of each result column
+func columnTypeNames(rows *sql.Rows) ([]string, error) {
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	typeNames := make([]string, len(columnTypes))
+	for i, columnType := range columnTypes {
+		typeNames[i] = columnType.DatabaseTypeName()
+	}
+	return typeNames, nil
+}
+
+// compactJSONValues validates and compacts the values of JSON columns in place
+func compactJSONValues(values []interface{}, cols, typeNames []string) error {
+	for i, val := range values {
+		s, ok := val.(string)
+		if !ok || typeNames[i] != "JSON" {
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, []byte(s)); err != nil {
+			return fmt.Errorf("column '%s' holds invalid JSON: %v", cols[i], err)
+		}
+		values[i] = buf.String()
+	}
+	return nil
+}
+
+// lowPriorityEngines are the storage engines with table-level locking that honor
+// INSERT LOW_PRIORITY
+var lowPriorityEngines = map[string]bool{"MyISAM": true, "MEMORY": true, "MERGE": true}
+
+// lowPriorityInsert adds LOW_PRIORITY to an INSERT or REPLACE verb when the destination
+// table's engine supports it, and returns the verb unchanged with a warning otherwise
+func lowPriorityInsert(db *sql.DB, tableName, verb string) (string, error) {
+	engine, err := getTableEngine(db, tableName)
+	if err != nil {
+		return "", err
+	}
+	if !lowPriorityEngines[engine] {
+		log.Printf("Warning: LOW_PRIORITY has no effect on %s table '%s', inserting normally\n", engine, tableName)
+		return verb, nil
+	}
+	return verb + " LOW_PRIORITY", nil
+}
+
+// getTableEngine returns the storage engine of a table, empty for views
+func getTableEngine(db *sql.DB, tableName string) (string, error) {
+	var engine sql.NullString
+	query := "SELECT engine FROM information_schema.tables WHERE table_schema = COALESCE(?, DATABASE()) AND table_name = ?"
+	schema, table := splitTableName(tableName)
+	if err := db.QueryRow(query, schema, table).Scan(&engine); err != nil {
+		return "", fmt.Errorf("error fetching table engine: %v", err)
+	}
+	return engine.String, nil
+}
+
+// insertStatement builds the insert of the quoted columns with their placeholders,
+// which bind argCount arguments, followed by the -setColumn constants, whose values it
+// returns to be bound after the column values
+func insertStatement(db *sql.DB, destTable string, quotedCols, params []string, argCount int, opts migrationOptions) (string, []interface{}, error) {
+	constants := make([]interface{}, len(opts.setColumns))
+	for i, constant := range opts.setColumns {
+		quotedCols = append(quotedCols, fmt.Sprintf("`%s`", constant.column))
+		params = append(params, placeholder(dialectMySQL, argCount+i+1))
+		constants[i] = constant.value
+	}
+
+	// REPLACE deletes a conflicting row and inserts the new one, so destination-only
+	// columns are reset to their defaults and delete triggers fire
+	verb := "INSERT"
+	if opts.onConflict == "replace" {
+		verb = "REPLACE"
+	}
+	if opts.lowPriority {
+		var err error
+		verb, err = lowPriorityInsert(db, destTable, verb)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	return fmt.Sprintf("%s INTO %s (%s) VALUES (%s)", verb, destTable, strings.Join(quotedCols, ", "), strings.Join(params, ", ")), constants, nil
+}
+
+// insertPlaceholders returns the VALUES placeholder of each column of the given types.
+// Spatial columns are rebuilt from their WKB and SRID with ST_GeomFromWKB.
+func insertPlaceholders(dialect string, typeNames []string) []string {
+	params := make([]string, len(typeNames))
+	position := 1
+	for i, typeName := range typeNames {
+		if typeName == "GEOMETRY" {
+			params[i] = fmt.Sprintf("ST_GeomFromWKB(%s, %s)", placeholder(dialect, position), placeholder(dialect, position+1))
+			position += 2
+		} else {
+			params[i] = placeholder(dialect, position)
+			position++
+		}
+	}
+	return params
+}
+
+// insertArgCount returns the number of arguments insertPlaceholders binds for the
+// columns, spatial columns taking two
+func insertArgCount(typeNames []string) int {
+	count := len(typeNames)
+	for _, typeName := range typeNames {
+		if typeName == "GEOMETRY" {
+			count++
+		}
+	}
+	return count
+}
+
+// defaultableColumns marks the columns whose NULLs should be replaced by the destination
+// default: NOT NULL columns with a literal default, which DEFAULT(col) can read
+func defaultableColumns(cols []string, destColumns []columnInfo) []bool {
+	destByName := make(map[string]columnInfo, len(destColumns))
+	for _, column := range destColumns {
+		destByName[column.name] = column
+	}
+
+	defaultable := make([]bool, len(cols))
+	for i, col := range cols {
+		column, ok := destByName[col]
+		if !ok || column.nullable || !column.defaultValue.Valid {
+			continue
+		}
+		if strings.Contains(column.extra, "DEFAULT_GENERATED") {
+			log.Printf("Warning: column '%s' has an expression default, NULLs cannot be replaced by it\n", col)
+			continue
+		}
+		defaultable[i] = true
+	}
+	return defaultable
+}
+
+// appendInsertArgs expands scanned values into insert arguments matching
+// insertPlaceholders and appends them to args, so a buffer can be reused across rows.
+// MySQL returns spatial values as a 4-byte little-endian SRID followed by the WKB.
+func appendInsertArgs(args []interface{}, values []interface{}, typeNames []string) []interface{} {
+	for i, val := range values {
+		if typeNames[i] != "GEOMETRY" {
+			args = append(args, val)
+			continue
+		}
+
+		b, ok := val.([]byte)
+		if !ok || len(b) < 4 {
+			args = append(args, val, nil)
+			continue
+		}
+		args = append(args, b[4:], binary.LittleEndian.Uint32(b[:4]))
+	}
+	return args
+}
+
+// renderStatement substitutes the arguments for the ? placeholders of a statement so a
+// failing insert can be rerun by hand. Placeholders inside `quoted` identifiers are kept.
+func renderStatement(query string, args []interface{}) string {
+	var b strings.Builder
+	quoted := false
+	next := 0
+	for _, r := range query {
+		switch {
+		case r == '`':
+			quoted = !quoted
+		case r == '?' && !quoted && next < len(args):
+			b.WriteString(renderValue(args[next]))
+			next++
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// renderValue formats an insert argument as an SQL literal
+func renderValue(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return quoteLiteral(v)
+	case []byte:
+		return fmt.Sprintf("X'%x'", v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// migrateData copies data from source table to destination table, reading the
+// source inside a read-only transaction at the configured isolation level. It returns
+// the number of rows migrated and the number of rows that failed to insert.
+func migrateData(ctx context.Context, srcDB, dstDB *sql.DB, sourceTable, destTable string, opts migrationOptions) (int, int, error) {
+	// Log the start of data migration
+	progressf("Starting data migration from '%s' to '%s'\n", sourceTable, destTable)
+	condition := opts.where[sourceTable]
+	if condition != "" {
+		progressf("Copying only rows matching: %s\n", condition)
+	}
+
+	// A source query is selected from like a derived table
+	from := sourceTable
+	if opts.sourceQuery != "" {
+		from = sourceQueryFrom(opts.sourceQuery)
+	}
+
+	// Prepare data extraction from source table
+	var totalRows int64
+	beforeQuery := snapshotHook(ctx, sourceTable, from, condition, &totalRows, opts)
+	source, err := openMigrationSource(ctx, srcDB, sourceTable, from, condition, beforeQuery, opts)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer source.close()
+	progressf("Data fetched from source table successfully.\n")
+
+	// Dynamically determine the number of columns
+	cols, typeNames := source.cols, source.typeNames
+	if len(cols) == 0 {
+		return 0, 0, fmt.Errorf("source table '%s' returned no columns", sourceTable)
+	}
+	progressf("Columns in source table: %v\n", cols)
+
+	// Shards are created alike, so the first one stands for all of them
+	dests := destinations(dstDB, opts)
+	destColumns, err := getColumns(dests[0], destTable)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error fetching destination columns: %v", err)
+	}
+	if err := checkInsertedColumns(cols, destColumns, opts.setColumns); err != nil {
+		return 0, 0, err
+	}
+	params, defaultable := insertParams(cols, typeNames, destColumns, opts.nullToDefault)
+
+	// Encrypted columns are sealed in Go so the destination only ever sees ciphertext
+	var encryptIndexes []int
+	if opts.encryptor != nil {
+		encryptIndexes, err = encryptedColumnIndexes(cols, opts.encryptColumns, destColumns)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	// Values too long for a narrower -retype column are truncated or rejected by the
+	// destination, so they are pointed out by key
+	lengthLimits := retypedLengthLimits(cols, opts.ddl.typeOverrides)
+
+	// Prepare insert statement for the destination table, naming the columns so the
+	// destination column order does not matter
+	quotedCols := make([]string, len(cols))
+	for i, col := range cols {
+		quotedCols[i] = fmt.Sprintf("`%s`", col)
+	}
+	sourceArgs := insertArgCount(typeNames)
+	insertStmt, constants, err := insertStatement(dests[0], destTable, quotedCols, params, sourceArgs, opts)
+	if err != nil {
+		return 0, 0, err
+	}
+	progressf("Insert Statement: %s\n", insertStmt)
+
+	writers, deads, err := openDestinations(ctx, dests, insertStmt, sourceTable, destTable, opts)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer writers.close()
+	progressf("Insert statement prepared successfully.\n")
+
+	// Keep the destination connections alive until the source produces its first row
+	stopKeepalive := startKeepalives(ctx, writers, opts.keepaliveInterval)
+	defer stopKeepalive()
+
+	keyIndexes, existingKeys, err := rowKeys(ctx, srcDB, dests, sourceTable, destTable, cols, len(lengthLimits) > 0, opts)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	opts.progressEvents.emit(progressEvent{Event: "start", Table: sourceTable, Total: totalRows})
+
+	// The insert arguments of every row are built in one buffer instead of allocating
+	// them per row
+	args := make([]interface{}, 0, sourceArgs+len(constants))
+
+	// Iterate over rows from the source table
+	counts := copyCounts{shardRows: make([]int, len(dests))}
+	for {
+		// A buffering driver can keep handing out rows after cancellation, so check
+		// before each row; the deferred source.close releases the source connection
+		select {
+		case <-ctx.Done():
+			return counts.rows - writers.rollback(), counts.failed, ctx.Err()
+		default:
+		}
+		if err := opts.replicaLag.wait(ctx); err != nil {
+			return counts.rows - writers.rollback(), counts.failed, err
+		}
+
+		values, err := source.next()
+		if err == io.EOF {
+			break
+		}
+		stopKeepalive()
+		if err != nil {
+			return counts.rows - writers.rollback(), counts.failed, err
+		}
+		rowNumber := counts.rows + 1
+		shard := 0
+		if len(writers) > 1 {
+			shard = shardOf(values, keyIndexes, len(writers))
+		}
+		writer, dead := writers[shard], deads[shard]
+
+		if existingKeys != nil && existingKeys[rowKey(values, keyIndexes)] {
+			counts.skipped++
+			continue
+		}
+
+		// Keep a single huge row from exceeding max_allowed_packet or bloating the batch
+		if oversized, err := checkRowSize(cols, values, keyIndexes, opts); err != nil {
+			return counts.rows - writers.rollback(), counts.failed, err
+		} else if oversized {
+			counts.oversized++
+			continue
+		}
+		warnRetypedLengths(cols, values, keyIndexes, lengthLimits)
+
+		// Insert JSON values compacted so strict JSON columns accept them
+		if err := compactJSONValues(values, cols, typeNames); err != nil {
+			log.Printf("Error converting row %d: %v\n", rowNumber, err)
+			dead.record(ctx, rowNumber, cols, values, err)
+			counts.failed++
+			continue
+		}
+
+		if err := encryptValues(values, encryptIndexes, opts.encryptor); err != nil {
+			return counts.rows - writers.rollback(), counts.failed, fmt.Errorf("error encrypting row %d: %v", rowNumber, err)
+		}
+		logRow(rowNumber, cols, values)
+
+		// Execute the insert statement
+		var start time.Time
+		if opts.slowRowThreshold > 0 {
+			start = time.Now()
+		}
+		args = append(appendInsertArgs(args[:0], values, typeNames), constants...)
+		result, err := writer.exec(ctx, args...)
+		if opts.slowRowThreshold > 0 {
+			if elapsed := time.Since(start); elapsed > opts.slowRowThreshold {
+				log.Printf("Warning: row %d (%s) took %s to insert\n", rowNumber, describeKey(cols, values, keyIndexes), elapsed)
+			}
+		}
+		if err != nil {
+			if err := fatalInsertError(ctx, destTable, err); err != nil {
+				return counts.rows - writers.rollback(), counts.failed, err
+			}
+			log.Printf("Error inserting row %d: %v\n", rowNumber, err)
+			if opts.logFailedSQL {
+				log.Printf("Failed statement for row %d: %s\n", rowNumber, renderStatement(insertStmt, args))
+			}
+			dead.record(ctx, rowNumber, cols, values, err)
+			counts.failed++
+			continue
+		}
+
+		// A wrong key under -onConflict replace overwrites rows it should not, which shows
+		// as more affected rows than expected
+		if affected, err := result.RowsAffected(); err == nil {
+			counts.affected += affected
+		}
+		if opts.maxAffectedRows > 0 && counts.affected > opts.maxAffectedRows {
+			migrated, err := abortAffectedRows(writers, destTable, counts, opts)
+			return migrated, counts.failed, err
+		}
+
+		// Surface silent truncation and coercion that MySQL only reports as warnings
+		if opts.logWarnings || opts.strictWarnings {
+			if err := checkInsertWarnings(ctx, writer, rowNumber, describeKey(cols, values, keyIndexes), opts.strictWarnings); err != nil {
+				return counts.rows - writers.rollback(), counts.failed, err
+			}
+		}
+
+		counts.rows++
+		counts.shardRows[shard]++
+		opts.rowsMigrated.Add(1)
+		counts.defaulted += countDefaulted(values, defaultable)
+		progressf("Successfully inserted row %d\n", counts.rows)
+
+		if err := writer.rowDone(); err != nil {
+			return counts.rows - writers.rollback(), counts.failed, err
+		}
+		if counts.rows%progressEventInterval == 0 {
+			opts.progressEvents.emit(progressEvent{Event: "progress", Table: sourceTable, Migrated: int64(counts.rows), Total: totalRows})
+		}
+	}
+
+	// Commit the final partial transactions
+	if err = writers.commit(); err != nil {
+		return counts.rows - writers.rollback(), counts.failed, err
+	}
+	if err := writers.finalize(ctx); err != nil {
+		return counts.rows, counts.failed, err
+	}
+
+	if err = source.finish(); err != nil {
+		return counts.rows, counts.failed, err
+	}
+
+	progressf("Data migration completed successfully. Total rows migrated: %d\n", counts.rows)
+	counts.report(opts)
+	return counts.rows, counts.failed, nil
+}
+
+// snapshotHook returns what runs in the source transaction just before the rows are
+// selected, if anything: recording the binlog position and GTID set the snapshot is
+// read at for a CDC handoff, and counting its rows into totalRows for progress events
+func snapshotHook(ctx context.Context, sourceTable, from, condition string, totalRows *int64, opts migrationOptions) func(*sql.Tx) error {
+	if opts.binlogPositions == nil && opts.progressEvents == nil {
+		return nil
+	}
+	return func(tx *sql.Tx) error {
+		if opts.binlogPositions != nil {
+			position := binlogPosition{Table: sourceTable}
+			var err error
+			if opts.captureBinlogPos {
+				position, err = captureBinlogPosition(ctx, tx, sourceTable)
+				if err != nil {
+					return err
+				}
+				progressf("Source binlog position for '%s': %s:%d\n", sourceTable, position.File, position.Position)
+			}
+			if opts.captureGTID {
+				position.GTIDExecuted, err = captureGTIDExecuted(ctx, tx)
+				if err != nil {
+					return err
+				}
+				progressf("Source executed GTIDs for '%s': %s\n", sourceTable, position.GTIDExecuted)
+			}
+			opts.binlogPositions.add(position)
+		}
+		if opts.progressEvents != nil {
+			query := fmt.Sprintf("SELECT COUNT(*) FROM %s%s", from, whereClause(condition))
+			if err := tx.QueryRowContext(ctx, query).Scan(totalRows); err != nil {
+				return fmt.Errorf("error counting source rows: %v", err)
+			}
+		}
+		return nil
+	}
+}
+
+// openMigrationSource opens the rows to copy: in chunks by primary key with
+// -chunkSize, otherwise in one query or from the -snapshotFile
+func openMigrationSource(ctx context.Context, srcDB *sql.DB, sourceTable, from, condition string, beforeQuery func(*sql.Tx) error, opts migrationOptions) (*sourceRows, error) {
+	if opts.chunkSize == 0 {
+		return openSourceRows(ctx, srcDB, from, condition, opts.isolation, beforeQuery, opts.snapshotFile, opts.refreshSnapshot)
+	}
+	// Chunks continue after the last primary key read
+	keyColumns, err := getPrimaryKeyColumns(srcDB, sourceTable)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching primary key: %v", err)
+	}
+	return chunkedRows(ctx, srcDB, from, condition, keyColumns, opts.isolation, beforeQuery, opts.chunkSize, opts.chunkPause)
+}
+
+// checkInsertedColumns checks the -setColumn columns against the source columns and
+// warns about the destination columns an insert of both would fail without. Other
+// destination-only columns take their defaults.
+func checkInsertedColumns(cols []string, destColumns []columnInfo, setColumns columnValues) error {
+	inserted := make(map[string]bool, len(cols))
+	for _, col := range cols {
+		inserted[col] = true
+	}
+	for _, constant := range setColumns {
+		if inserted[constant.column] {
+			return fmt.Errorf("-setColumn column '%s' is also a source column", constant.column)
+		}
+		inserted[constant.column] = true
+	}
+	for _, column := range destColumns {
+		if !inserted[column.name] && requiresValue(column) {
+			log.Printf("Warning: destination column '%s' is not in the source and is NOT NULL without a default, inserts may fail\n", column.name)
+		}
+	}
+	return nil
+}
+
+// insertParams returns the insert placeholders of the source columns. With
+// nullToDefault, NULLs for NOT NULL destination columns fall back to the column
+// default, and defaultable reports the columns that can.
+func insertParams(cols, typeNames []string, destColumns []columnInfo, nullToDefault bool) (params []string, defaultable []bool) {
+	params = insertPlaceholders(dialectMySQL, typeNames)
+	if nullToDefault {
+		defaultable = defaultableColumns(cols, destColumns)
+		for i := range params {
+			if defaultable[i] {
+				params[i] = fmt.Sprintf("COALESCE(%s, DEFAULT(`%s`))", params[i], cols[i])
+			}
+		}
+	}
+	return params, defaultable
+}
+
+// openDestinations gives every destination, one per shard, its own connection and
+// prepared insert. Failed rows are kept on the destination they were meant for in
+// -deadLetterTable, for inspection and reprocessing; without it the dead letters are nil.
+func openDestinations(ctx context.Context, dests []*sql.DB, insertStmt, sourceTable, destTable string, opts migrationOptions) (destWriters, []*deadLetters, error) {
+	var writers destWriters
+	for _, db := range dests {
+		writer, err := openDestWriter(ctx, db, insertStmt, opts)
+		if err != nil {
+			writers.close()
+			return nil, nil, err
+		}
+		writers = append(writers, writer)
+	}
+
+	deads := make([]*deadLetters, len(dests))
+	if opts.deadLetterTable != "" {
+		for i, db := range dests {
+			var err error
+			deads[i], err = openDeadLetters(ctx, db, opts.deadLetterTable, sourceTable, destTable)
+			if err != nil {
+				writers.close()
+				return nil, nil, err
+			}
+		}
+	}
+	return writers, deads, nil
+}
+
+// startKeepalives pings the connection of every writer at interval, if set, until
+// the returned stop is called. stop may be called again.
+func startKeepalives(ctx context.Context, writers destWriters, interval time.Duration) (stop func()) {
+	var stops []func()
+	if interval > 0 {
+		for _, writer := range writers {
+			stops = append(stops, startKeepalive(ctx, writer.conn, interval))
+		}
+	}
+	return func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}
+}
+
+// rowKeys returns the primary key positions in cols when an option needs them: to
+// identify rows in slow insert, warning and length logs, to route rows to shards and
+// to skip the keys already on the destinations with -skipExisting, which it also returns
+func rowKeys(ctx context.Context, srcDB *sql.DB, dests []*sql.DB, sourceTable, destTable string, cols []string, logLengths bool, opts migrationOptions) ([]int, map[string]bool, error) {
+	if opts.slowRowThreshold <= 0 && !opts.logWarnings && !opts.strictWarnings && !opts.skipExisting && opts.maxRowBytes <= 0 && !logLengths && len(opts.shards) == 0 {
+		return nil, nil, nil
+	}
+	keyColumns, err := getPrimaryKeyColumns(srcDB, sourceTable)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error fetching primary key: %v", err)
+	}
+	keyIndexes := columnIndexes(cols, keyColumns)
+	hasKey := len(keyColumns) > 0 && len(keyIndexes) == len(keyColumns)
+
+	// Rows are routed to their shard by primary key
+	if len(opts.shards) > 0 && !hasKey {
+		return nil, nil, fmt.Errorf("-destShards requires a primary key on source table '%s'", sourceTable)
+	}
+	if !opts.skipExisting {
+		return keyIndexes, nil, nil
+	}
+
+	// Rows already on the destination are skipped by key instead of failing the insert
+	if !hasKey {
+		return nil, nil, fmt.Errorf("-skipExisting requires a primary key on source table '%s'", sourceTable)
+	}
+	existingKeys := make(map[string]bool)
+	for _, db := range dests {
+		keys, err := getExistingKeys(ctx, db, destTable, keyColumns)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error fetching existing destination keys: %v", err)
+		}
+		for key := range keys {
+			existingKeys[key] = true
+		}
+	}
+	progressf("Destination table '%s' already holds %d rows\n", destTable, len(existingKeys))
+	return keyIndexes, existingKeys, nil
+}
+
+// checkRowSize reports whether a row is over -maxRowBytes and skipped, or fails for it
+// with -oversizedRowPolicy fail
+func checkRowSize(cols []string, values []interface{}, keyIndexes []int, opts migrationOptions) (bool, error) {
+	if opts.maxRowBytes <= 0 {
+		return false, nil
+	}
+	size := rowSize(values)
+	if size <= opts.maxRowBytes {
+		return false, nil
+	}
+	if opts.oversizedRowPolicy == "fail" {
+		return false, fmt.Errorf("row (%s) is %d bytes, over -maxRowBytes %d", describeKey(cols, values, keyIndexes), size, opts.maxRowBytes)
+	}
+	log.Printf("Warning: skipping row (%s) of %d bytes, over -maxRowBytes %d\n", describeKey(cols, values, keyIndexes), size, opts.maxRowBytes)
+	return true, nil
+}
+
+// warnRetypedLengths logs the values of a row longer than their -retype column allows
+func warnRetypedLengths(cols []string, values []interface{}, keyIndexes []int, lengthLimits map[int]lengthLimit) {
+	for index, limit := range lengthLimits {
+		if length := limit.valueLength(values[index]); length > limit.length {
+			log.Printf("Warning: row (%s) column '%s' holds %d %s, more than its -retype %s allows\n", describeKey(cols, values, keyIndexes), cols[index], length, limit.unit(), limit.columnType)
+		}
+	}
+}
+
+// fatalInsertError returns the error that stops the copy for a failed insert, or nil
+// if only the row failed
+func fatalInsertError(ctx context.Context, destTable string, err error) error {
+	// Stop instead of failing every remaining row once cancelled
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	// Every remaining row would fail the same way
+	if isDiskFullError(err) {
+		return fmt.Errorf("destination '%s' is out of space, free disk space or raise the tablespace limit and rerun: %v", destTable, err)
+	}
+	return nil
+}
+
+// countDefaulted counts the NULL values of a row its destination columns default
+func countDefaulted(values []interface{}, defaultable []bool) int {
+	count := 0
+	for i, isDefaultable := range defaultable {
+		if isDefaultable && values[i] == nil {
+			count++
+		}
+	}
+	return count
+}
+
+// logRow prints the row data for debugging purposes
+func logRow(rowNumber int, cols []string, values []interface{}) {
+	rowData := make([]string, len(cols))
+	for i, col := range cols {
+		rowData[i] = fmt.Sprintf("%s: %v", col, values[i])
+	}
+	progressf("Row %d: %v\n", rowNumber, strings.Join(rowData, ", "))
+}
+
+// abortAffectedRows stops a copy whose affected rows went over -maxAffectedRows with
+// the row just inserted, returning how many rows stay migrated
+func abortAffectedRows(writers destWriters, destTable string, counts copyCounts, opts migrationOptions) (int, error) {
+	rowNumber := counts.rows + 1
+	// Autocommitted rows, this one included, are already in the destination
+	if opts.rowsPerTransaction <= 0 {
+		return rowNumber, fmt.Errorf("%d rows affected on '%s' after row %d, over -maxAffectedRows %d; all %d rows so far were autocommitted", counts.affected, destTable, rowNumber, opts.maxAffectedRows, rowNumber)
+	}
+	lost := writers.rollback()
+	return counts.rows - lost, fmt.Errorf("%d rows affected on '%s' after row %d, over -maxAffectedRows %d; %d rows were committed, the %d of the open transaction were rolled back", counts.affected, destTable, rowNumber, opts.maxAffectedRows, counts.rows-lost, lost+1)
+}
+
+// checkInsertWarnings logs the warnings of the last insert, failing with strict
+func checkInsertWarnings(ctx context.Context, writer *destWriter, rowNumber int, key string, strict bool) error {
+	warnings, err := writer.warnings(ctx)
+	if err != nil {
+		return err
+	}
+	for _, warning := range warnings {
+		log.Printf("Warning inserting row %d (%s): %s\n", rowNumber, key, warning)
+	}
+	if len(warnings) > 0 && strict {
+		return fmt.Errorf("row %d raised %d warning(s) with -strictWarnings", rowNumber, len(warnings))
+	}
+	return nil
+}
+
+// copyCounts tallies the rows of one table copy by outcome
+type copyCounts struct {
+	rows      int
+	failed    int
+	skipped   int
+	oversized int
+	defaulted int
+	affected  int64
+	shardRows []int
+}
+
+// report prints the counts the enabled options make relevant
+func (c copyCounts) report(opts migrationOptions) {
+	for i, shard := range opts.shards {
+		progressf("Rows migrated into shard '%s': %d\n", shard.name, c.shardRows[i])
+	}
+	if opts.nullToDefault {
+		progressf("NULL values replaced by destination defaults: %d\n", c.defaulted)
+	}
+	if opts.skipExisting {
+		progressf("Rows skipped because they already exist: %d\n", c.skipped)
+	}
+	if opts.maxRowBytes > 0 {
+		progressf("Rows skipped because they exceed -maxRowBytes: %d\n", c.oversized)
+	}
+	if opts.onConflict == "replace" || opts.maxAffectedRows > 0 {
+		progressf("Rows affected on the destination: %d\n", c.affected)
+	}
 }
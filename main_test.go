@@ -0,0 +1,573 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// benchRowCount is the number of rows the benchmark driver returns per query
+const benchRowCount = 1000
+
+// benchDriver is a database/sql driver whose queries return benchRowCount rows of an
+// int, a text and a binary column, so row handling can be measured without a server
+type benchDriver struct{}
+
+func (benchDriver) Open(string) (driver.Conn, error) { return benchConn{}, nil }
+
+type benchConn struct{}
+
+func (benchConn) Prepare(string) (driver.Stmt, error) { return benchStmt{}, nil }
+func (benchConn) Close() error                        { return nil }
+func (benchConn) Begin() (driver.Tx, error)           { return nil, driver.ErrSkip }
+
+type benchStmt struct{}
+
+func (benchStmt) Close() error                               { return nil }
+func (benchStmt) NumInput() int                              { return 0 }
+func (benchStmt) Exec([]driver.Value) (driver.Result, error) { return driver.ResultNoRows, nil }
+func (benchStmt) Query([]driver.Value) (driver.Rows, error)  { return &benchRows{}, nil }
+
+type benchRows struct {
+	next int
+}
+
+func (r *benchRows) Columns() []string { return []string{"id", "name", "payload"} }
+func (r *benchRows) Close() error      { return nil }
+
+func (r *benchRows) Next(dest []driver.Value) error {
+	if r.next == benchRowCount {
+		return io.EOF
+	}
+	r.next++
+	dest[0] = int64(r.next)
+	dest[1] = []byte("some name")
+	dest[2] = []byte("some binary payload")
+	return nil
+}
+
+func init() {
+	sql.Register("bench", benchDriver{})
+	sql.Register("fake", fakeDriver{})
+}
+
+var benchTypeNames = []string{"INT", "VARCHAR", "BLOB"}
+
+// benchmarkRows scans and builds the insert arguments of every row of a query the way
+// migrateData does, with buffers allocated per row or reused
+func benchmarkRows(b *testing.B, reuse bool) {
+	db, err := sql.Open("bench", "")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		rows, err := db.Query("SELECT")
+		if err != nil {
+			b.Fatal(err)
+		}
+		scanner := newRowScanner(benchTypeNames)
+		args := make([]interface{}, 0, len(benchTypeNames))
+		for rows.Next() {
+			if reuse {
+				values, err := scanner.scan(rows)
+				if err != nil {
+					b.Fatal(err)
+				}
+				args = appendInsertArgs(args[:0], values, benchTypeNames)
+			} else {
+				values, err := scanRow(rows, benchTypeNames)
+				if err != nil {
+					b.Fatal(err)
+				}
+				args = appendInsertArgs(nil, values, benchTypeNames)
+			}
+		}
+		if err := rows.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(b.N*benchRowCount)/b.Elapsed().Seconds(), "rows/s")
+}
+
+func BenchmarkRowsAllocatedPerRow(b *testing.B) { benchmarkRows(b, false) }
+func BenchmarkRowsReusedBuffers(b *testing.B)   { benchmarkRows(b, true) }
+
+// fakeDB is a scripted database for tests. query answers every query, with no rows
+// when it is nil or returns nil, and every statement run is recorded in order.
+type fakeDB struct {
+	query    func(query string, args []driver.Value) *fakeRows
+	exec     func(query string, args []driver.Value) error
+	prepared func(query string)
+
+	mu         sync.Mutex
+	statements []string
+}
+
+// fakeDBs are the fake databases by the DSN openFake registered them under
+var (
+	fakeDBsMu sync.Mutex
+	fakeDBs   = make(map[string]*fakeDB)
+)
+
+// openFake opens f through the fake driver, closing it when the test ends
+func openFake(t *testing.T, f *fakeDB) *sql.DB {
+	t.Helper()
+	fakeDBsMu.Lock()
+	dsn := fmt.Sprintf("%s/%d", t.Name(), len(fakeDBs))
+	fakeDBs[dsn] = f
+	fakeDBsMu.Unlock()
+
+	db, err := sql.Open("fake", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// ran reports whether a statement starting with prefix was run
+func (f *fakeDB) ran(prefix string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, statement := range f.statements {
+		if strings.HasPrefix(statement, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fakeDB) record(query string) {
+	f.mu.Lock()
+	f.statements = append(f.statements, query)
+	f.mu.Unlock()
+}
+
+func (f *fakeDB) runQuery(query string, args []driver.Value) (driver.Rows, error) {
+	f.record(query)
+	var rows *fakeRows
+	if f.query != nil {
+		rows = f.query(query, args)
+	}
+	if rows == nil {
+		rows = &fakeRows{}
+	}
+	return &fakeRows{cols: rows.cols, typeNames: rows.typeNames, rows: rows.rows}, nil
+}
+
+func (f *fakeDB) runExec(query string, args []driver.Value) (driver.Result, error) {
+	f.record(query)
+	if f.exec != nil {
+		if err := f.exec(query, args); err != nil {
+			return nil, err
+		}
+	}
+	return driver.RowsAffected(1), nil
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	fakeDBsMu.Lock()
+	defer fakeDBsMu.Unlock()
+	f, ok := fakeDBs[dsn]
+	if !ok {
+		return nil, fmt.Errorf("no fake database '%s'", dsn)
+	}
+	return fakeConn{f}, nil
+}
+
+// fakeConn runs plain queries and execs directly, so only explicit prepares reach
+// the prepared hook
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	if c.db.prepared != nil {
+		c.db.prepared(query)
+	}
+	return fakeStmt{c.db, query}, nil
+}
+
+func (c fakeConn) Close() error              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+func (c fakeConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return fakeTx{}, nil
+}
+
+func (c fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.db.runQuery(query, namedValues(args))
+}
+
+func (c fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.db.runExec(query, namedValues(args))
+}
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.db.runExec(s.query, args)
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.db.runQuery(s.query, args)
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+// fakeRows is a query result. Columns without a type name are VARCHAR.
+type fakeRows struct {
+	cols      []string
+	typeNames []string
+	rows      [][]driver.Value
+	next      int
+}
+
+func (r *fakeRows) Columns() []string { return r.cols }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) ColumnTypeDatabaseTypeName(index int) string {
+	if index < len(r.typeNames) && r.typeNames[index] != "" {
+		return r.typeNames[index]
+	}
+	return "VARCHAR"
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next == len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
+
+func TestFormatDefault(t *testing.T) {
+	tests := []struct {
+		fieldType string
+		value     string
+		generated bool
+		want      string
+		exact     bool
+	}{
+		{"int(11)", "5", false, "5", true},
+		{"decimal(10,2) unsigned", "1.50", false, "1.50", true},
+		{"int", "abc", false, "'abc'", false},
+		{"varchar(20)", "it's", false, "'it''s'", true},
+		{"varchar(20)", `C:\tmp`, false, `'C:\\tmp'`, true},
+		{"bit(1)", "b'1'", false, "b'1'", true},
+		{"bit(1)", "1", false, "'1'", false},
+		{"timestamp", "current_timestamp()", false, "CURRENT_TIMESTAMP", true},
+		{"datetime(3)", "CURRENT_TIMESTAMP(3)", false, "CURRENT_TIMESTAMP(3)", true},
+		{"varchar(36)", "uuid()", true, "(uuid())", true},
+	}
+	for _, tt := range tests {
+		got, exact := formatDefault(tt.fieldType, tt.value, tt.generated)
+		if got != tt.want || exact != tt.exact {
+			t.Errorf("formatDefault(%q, %q, %v) = %q, %v, want %q, %v", tt.fieldType, tt.value, tt.generated, got, exact, tt.want, tt.exact)
+		}
+	}
+}
+
+func TestCompactJSONValues(t *testing.T) {
+	cols := []string{"id", "doc", "note"}
+	typeNames := []string{"INT", "JSON", "VARCHAR"}
+	values := []interface{}{int64(1), "{ \"a\": [1, 2] }", "{ \"b\": 1 }"}
+	if err := compactJSONValues(values, cols, typeNames); err != nil {
+		t.Fatalf("compactJSONValues() error = %v", err)
+	}
+	want := []interface{}{int64(1), `{"a":[1,2]}`, "{ \"b\": 1 }"}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("compactJSONValues() = %q, want %q", values, want)
+	}
+
+	// NULL JSON values are left alone
+	values = []interface{}{int64(2), nil, "x"}
+	if err := compactJSONValues(values, cols, typeNames); err != nil || values[1] != nil {
+		t.Errorf("compactJSONValues() with NULL = %v, %v, want nil value and no error", values[1], err)
+	}
+
+	values = []interface{}{int64(3), "{broken", "x"}
+	if err := compactJSONValues(values, cols, typeNames); err == nil || !strings.Contains(err.Error(), "'doc'") {
+		t.Errorf("compactJSONValues() with invalid JSON error = %v, want one naming column 'doc'", err)
+	}
+}
+
+func TestAppendInsertArgs(t *testing.T) {
+	typeNames := []string{"INT", "GEOMETRY", "VARCHAR"}
+	// SRID 4326 in little-endian order, followed by the WKB
+	point := []byte{0xe6, 0x10, 0x00, 0x00, 0x01, 0x01, 0x00, 0x00, 0x00}
+	tests := []struct {
+		name   string
+		values []interface{}
+		want   []interface{}
+	}{
+		{"spatial", []interface{}{int64(1), point, "a"}, []interface{}{int64(1), point[4:], uint32(4326), "a"}},
+		{"null spatial", []interface{}{int64(2), nil, "b"}, []interface{}{int64(2), nil, nil, "b"}},
+		{"short spatial", []interface{}{int64(3), []byte{1, 2}, "c"}, []interface{}{int64(3), []byte{1, 2}, nil, "c"}},
+	}
+	for _, tt := range tests {
+		got := appendInsertArgs(nil, tt.values, typeNames)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: appendInsertArgs() = %v, want %v", tt.name, got, tt.want)
+		}
+		if len(got) != insertArgCount(typeNames) {
+			t.Errorf("%s: appendInsertArgs() gave %d arguments, insertPlaceholders binds %d", tt.name, len(got), insertArgCount(typeNames))
+		}
+	}
+
+	// Appending reuses the buffer
+	buf := make([]interface{}, 0, 8)
+	got := appendInsertArgs(buf[:0], tests[0].values, typeNames)
+	if &got[0] != &buf[:1][0] {
+		t.Error("appendInsertArgs() did not append to the given buffer")
+	}
+}
+
+func TestMigrateDataKeepsTimestampText(t *testing.T) {
+	// Without parseTime the driver reads TIMESTAMP as text in the source session
+	// time_zone, and the destination session reads it back in its own, so pinning
+	// both to one zone keeps the instant. The value must not pass through the local
+	// zone of the process on the way.
+	local := time.Local
+	time.Local = time.FixedZone("UTC+3", 3*60*60)
+	defer func() { time.Local = local }()
+
+	const stamp = "2024-03-31 02:30:00.123456"
+	src := openFake(t, &fakeDB{query: func(string, []driver.Value) *fakeRows {
+		return &fakeRows{cols: []string{"id", "created_at"}, typeNames: []string{"INT", "TIMESTAMP"}, rows: [][]driver.Value{{int64(1), []byte(stamp)}}}
+	}})
+	var got driver.Value
+	dst := openFake(t, &fakeDB{exec: func(query string, args []driver.Value) error {
+		if strings.HasPrefix(query, "INSERT") {
+			got = args[1]
+		}
+		return nil
+	}})
+	if _, _, err := migrateData(context.Background(), src, dst, "src", "forms", migrationOptions{rowsMigrated: new(atomic.Int64)}); err != nil {
+		t.Fatal(err)
+	}
+	if got != stamp {
+		t.Errorf("inserted created_at = %#v, want %q", got, stamp)
+	}
+}
+
+func TestMigrateDataNoColumns(t *testing.T) {
+	src := openFake(t, &fakeDB{})
+	dst := openFake(t, &fakeDB{})
+	_, _, err := migrateData(context.Background(), src, dst, "src", "dst", migrationOptions{})
+	if err == nil || !strings.Contains(err.Error(), "returned no columns") {
+		t.Fatalf("migrateData() error = %v, want a no columns error", err)
+	}
+}
+
+func TestQuoteLiteral(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", "''"},
+		{"plain comment", "'plain comment'"},
+		{"owner's id", "'owner''s id'"},
+		{`path C:\data\`, `'path C:\\data\\'`},
+	}
+	for _, tt := range tests {
+		if got := quoteLiteral(tt.value); got != tt.want {
+			t.Errorf("quoteLiteral(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestMigrateDataPreservesIds(t *testing.T) {
+	src := openFake(t, &fakeDB{query: func(string, []driver.Value) *fakeRows {
+		return &fakeRows{cols: []string{"id", "name"}, typeNames: []string{"INT"}, rows: [][]driver.Value{{int64(42), []byte("a")}, {int64(0), []byte("b")}}}
+	}})
+	var mu sync.Mutex
+	var statements []string
+	var ids []driver.Value
+	dst := openFake(t, &fakeDB{exec: func(query string, args []driver.Value) error {
+		if strings.HasPrefix(query, "INSERT") {
+			mu.Lock()
+			statements = append(statements, query)
+			ids = append(ids, args[0])
+			mu.Unlock()
+		}
+		return nil
+	}})
+	opts := migrationOptions{rowsMigrated: new(atomic.Int64)}
+	if _, _, err := migrateData(context.Background(), src, dst, "src", "forms", opts); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each row names the id column and binds the source id, 0 included, rather than
+	// leaving the id to auto-increment
+	for _, statement := range statements {
+		if !strings.HasPrefix(statement, "INSERT INTO forms (`id`, `name`)") {
+			t.Errorf("insert statement = %q, want the id column listed", statement)
+		}
+	}
+	if want := []driver.Value{int64(42), int64(0)}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("inserted ids = %#v, want %#v", ids, want)
+	}
+}
+
+func TestMigrateDataOnConflict(t *testing.T) {
+	tests := []struct {
+		onConflict string
+		want       string
+	}{
+		{"error", "INSERT INTO dst (`id`, `name`) VALUES (?, ?)"},
+		{"replace", "REPLACE INTO dst (`id`, `name`) VALUES (?, ?)"},
+	}
+	for _, tt := range tests {
+		src := openFake(t, &fakeDB{query: func(string, []driver.Value) *fakeRows {
+			return &fakeRows{cols: []string{"id", "name"}, typeNames: []string{"INT"}, rows: [][]driver.Value{{int64(1), []byte("a")}}}
+		}})
+		dst := &fakeDB{}
+		migrated, failed, err := migrateData(context.Background(), src, openFake(t, dst), "src", "dst", migrationOptions{onConflict: tt.onConflict, rowsMigrated: new(atomic.Int64)})
+		if err != nil || migrated != 1 || failed != 0 {
+			t.Fatalf("migrateData() = %d, %d, %v, want 1 row migrated", migrated, failed, err)
+		}
+		if !dst.ran(tt.want) {
+			t.Errorf("-onConflict %s did not run %q, ran %q", tt.onConflict, tt.want, dst.statements)
+		}
+	}
+}
+
+func TestLowPriorityInsert(t *testing.T) {
+	tests := []struct {
+		engine string
+		verb   string
+		want   string
+	}{
+		{"MyISAM", "INSERT", "INSERT LOW_PRIORITY"},
+		{"MyISAM", "REPLACE", "REPLACE LOW_PRIORITY"},
+		{"InnoDB", "INSERT", "INSERT"},
+		{"InnoDB", "REPLACE", "REPLACE"},
+	}
+	for _, tt := range tests {
+		db := openFake(t, &fakeDB{query: func(string, []driver.Value) *fakeRows {
+			return &fakeRows{cols: []string{"engine"}, rows: [][]driver.Value{{tt.engine}}}
+		}})
+		got, err := lowPriorityInsert(db, "forms", tt.verb)
+		if err != nil {
+			t.Fatalf("lowPriorityInsert() error = %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("lowPriorityInsert(%s, %q) = %q, want %q", tt.engine, tt.verb, got, tt.want)
+		}
+	}
+}
+
+func TestMigrateDataStopsOnCancel(t *testing.T) {
+	// A -snapshotFile source keeps handing out rows after cancellation, unlike rows
+	// database/sql closes, so record one first. Its invalid JSON row would be counted
+	// as failed without reaching the destination if the copy went on.
+	rows := [][]driver.Value{{int64(1), []byte("{")}, {int64(2), []byte("{}")}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cancelOnKeyLookup := false
+	src := openFake(t, &fakeDB{query: func(query string, _ []driver.Value) *fakeRows {
+		if strings.Contains(query, "information_schema.statistics") {
+			if cancelOnKeyLookup {
+				cancel()
+			}
+			return nil
+		}
+		return &fakeRows{cols: []string{"id", "doc"}, typeNames: []string{"INT", "JSON"}, rows: rows}
+	}})
+	opts := migrationOptions{
+		snapshotFile: filepath.Join(t.TempDir(), "src.snapshot"),
+		rowsMigrated: new(atomic.Int64),
+	}
+	if migrated, failed, err := migrateData(context.Background(), src, openFake(t, &fakeDB{}), "src", "dst", opts); err != nil || migrated != 1 || failed != 1 {
+		t.Fatalf("recording the snapshot: migrateData() = %d, %d, %v, want 1 row migrated and 1 failed", migrated, failed, err)
+	}
+
+	// Cancel once the copy is ready to insert: -slowRowThreshold looks up the primary
+	// key after the inserts are prepared
+	cancelOnKeyLookup = true
+	opts.slowRowThreshold = time.Hour
+	dst := &fakeDB{}
+	migrated, failed, err := migrateData(ctx, src, openFake(t, dst), "src", "dst", opts)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("migrateData() error = %v, want %v", err, context.Canceled)
+	}
+	if migrated != 0 || failed != 0 || dst.ran("INSERT") {
+		t.Errorf("migrateData() went on with %d migrated and %d failed rows after cancellation", migrated, failed)
+	}
+}
+
+func TestMigrateDataKeepsFourByteCharacters(t *testing.T) {
+	// U+1F600 takes four bytes in UTF-8, which only utf8mb4 stores
+	const text = "hi \U0001F600"
+	src := openFake(t, &fakeDB{query: func(string, []driver.Value) *fakeRows {
+		return &fakeRows{cols: []string{"id", "name"}, typeNames: []string{"INT"}, rows: [][]driver.Value{{int64(1), []byte(text)}}}
+	}})
+	var got driver.Value
+	dst := openFake(t, &fakeDB{exec: func(query string, args []driver.Value) error {
+		if strings.HasPrefix(query, "INSERT") {
+			got = args[1]
+		}
+		return nil
+	}})
+	if _, _, err := migrateData(context.Background(), src, dst, "src", "forms", migrationOptions{rowsMigrated: new(atomic.Int64)}); err != nil {
+		t.Fatal(err)
+	}
+	if got != text {
+		t.Errorf("inserted name = %q, want %q", got, text)
+	}
+}
+
+func TestMigrateDataOnConflictBehaviour(t *testing.T) {
+	src := openFake(t, &fakeDB{query: func(string, []driver.Value) *fakeRows {
+		return &fakeRows{cols: []string{"id", "name"}, typeNames: []string{"INT"}, rows: [][]driver.Value{{int64(1), []byte("new")}, {int64(2), []byte("b")}}}
+	}})
+	tests := []struct {
+		onConflict string
+		failed     int
+		want       map[int64]string
+	}{
+		{"error", 1, map[int64]string{1: "old csv", 2: "b csv"}},
+		{"replace", 0, map[int64]string{1: "new csv", 2: "b csv"}},
+	}
+	for _, tt := range tests {
+		table := &keyedTable{rows: map[int64]string{1: "old csv"}}
+		opts := migrationOptions{
+			onConflict:   tt.onConflict,
+			setColumns:   columnValues{{column: "source", value: "csv"}},
+			rowsMigrated: new(atomic.Int64),
+		}
+		_, failed, err := migrateData(context.Background(), src, openFake(t, table.fake()), "src", "forms", opts)
+		if err != nil || failed != tt.failed {
+			t.Errorf("-onConflict %s: migrateData() = %d failed, %v, want %d failed", tt.onConflict, failed, err, tt.failed)
+		}
+		if !reflect.DeepEqual(table.rows, tt.want) {
+			t.Errorf("-onConflict %s: table holds %v, want %v", tt.onConflict, table.rows, tt.want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Manifest table statuses
+const (
+	manifestPending    = "pending"
+	manifestInProgress = "in-progress"
+	manifestDone       = "done"
+	manifestFailed     = "failed"
+)
+
+// manifestTable is the state of one table in the -manifest file
+type manifestTable struct {
+	Source   string    `json:"source"`
+	Dest     string    `json:"dest"`
+	Status   string    `json:"status"`
+	Migrated int       `json:"migrated"`
+	Failed   int       `json:"failed"`
+	Error    string    `json:"error,omitempty"`
+	Updated  time.Time `json:"updated"`
+}
+
+// migrationManifest records the state of every table of a multi-table run in a JSON
+// file, rewritten as tables start and finish. A nil manifest records nothing.
+type migrationManifest struct {
+	mu     sync.Mutex
+	path   string
+	Tables []manifestTable `json:"tables"`
+}
+
+// readManifest loads the manifest at path, or returns nil if there is none yet
+func readManifest(path string) (*migrationManifest, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %v", err)
+	}
+	manifest := &migrationManifest{path: path}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %v", err)
+	}
+	return manifest, nil
+}
+
+// newManifest starts a manifest for the tables, keeping the entries of previous that
+// are done so a resumed run still lists them
+func newManifest(path string, tables []tablePair, previous *migrationManifest) *migrationManifest {
+	manifest := &migrationManifest{path: path}
+	for _, table := range tables {
+		entry := manifestTable{Source: table.source, Dest: table.dest, Status: manifestPending}
+		if prior, ok := previous.find(table); ok && prior.Status == manifestDone {
+			entry = prior
+		}
+		manifest.Tables = append(manifest.Tables, entry)
+	}
+	return manifest
+}
+
+// find returns the entry of a table pair
+func (m *migrationManifest) find(table tablePair) (manifestTable, bool) {
+	if m == nil {
+		return manifestTable{}, false
+	}
+	for _, entry := range m.Tables {
+		if entry.Source == table.source && entry.Dest == table.dest {
+			return entry, true
+		}
+	}
+	return manifestTable{}, false
+}
+
+// update sets the status and counts of a table and rewrites the file. Write errors
+// are logged rather than failing the migration the manifest only describes.
+func (m *migrationManifest) update(table tablePair, status string, result tableResult, migrateErr error) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.Tables {
+		entry := &m.Tables[i]
+		if entry.Source != table.source || entry.Dest != table.dest {
+			continue
+		}
+		entry.Status = status
+		entry.Migrated = result.migrated
+		entry.Failed = result.failed
+		entry.Error = ""
+		if migrateErr != nil {
+			entry.Error = migrateErr.Error()
+		}
+		entry.Updated = time.Now().UTC()
+	}
+	if err := m.write(); err != nil {
+		log.Printf("Error writing manifest: %v\n", err)
+	}
+}
+
+// write replaces the manifest file through a rename, so readers never see a partial file
+func (m *migrationManifest) write() error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	temp := m.path + ".tmp"
+	if err := os.WriteFile(temp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(temp, m.path)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// optionFileKeys are the my.cnf options understood by -defaultsFile; others are ignored
+var optionFileKeys = map[string]bool{"host": true, "user": true, "password": true, "port": true}
+
+// readOptionFile reads host, user, password and port from a MySQL option file (my.cnf).
+// Options from the [client] group are read first and then overridden by those in
+// group, when it names a different group. A password option without a value leaves the
+// password out, so it is asked for as the mysql client does.
+func readOptionFile(path, group string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open option file: %v", err)
+	}
+	defer file.Close()
+
+	clientOptions := make(map[string]string)
+	groupOptions := make(map[string]string)
+	var current map[string]string
+	// askPassword is set for the groups whose last password option has no value
+	askPassword := make(map[string]bool)
+	currentGroup := ""
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "!") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			currentGroup = strings.TrimSpace(line[1 : len(line)-1])
+			switch currentGroup {
+			case "client":
+				current = clientOptions
+			case group:
+				current = groupOptions
+			default:
+				current = nil
+			}
+			continue
+		}
+		if current == nil {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		key = strings.ReplaceAll(strings.TrimSpace(key), "_", "-")
+		if !optionFileKeys[key] {
+			continue
+		}
+		if key == "password" {
+			askPassword[currentGroup] = !found
+			if !found {
+				delete(current, key)
+				continue
+			}
+		}
+		current[key] = unquoteOptionValue(strings.TrimSpace(value))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read option file: %v", err)
+	}
+
+	for key, value := range groupOptions {
+		clientOptions[key] = value
+	}
+	if group != "client" && askPassword[group] {
+		delete(clientOptions, "password")
+	}
+	return clientOptions, nil
+}
+
+// unquoteOptionValue strips matching single or double quotes around an option value
+func unquoteOptionValue(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// applyOptionFile fills the connection flags that were not set explicitly on the
+// command line from the option file. A port from the file is added to hosts that do
+// not name one. It reports whether the file supplied the password.
+func applyOptionFile(path, group string, sourceHost, destHost, user, password *string) (bool, error) {
+	options, err := readOptionFile(path, group)
+	if err != nil {
+		return false, err
+	}
+
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	setDefault := func(name string, target *string, key string) {
+		if value, ok := options[key]; ok && !explicit[name] {
+			*target = value
+		}
+	}
+	setDefault("sourceHost", sourceHost, "host")
+	setDefault("destHost", destHost, "host")
+	setDefault("dbUser", user, "user")
+	setDefault("dbPassword", password, "password")
+
+	if port, ok := options["port"]; ok {
+		for _, host := range []*string{sourceHost, destHost} {
+			*host = hostWithPort(*host, port)
+		}
+	}
+	_, hasPassword := options["password"]
+	return hasPassword, nil
+}
+
+// hostWithPort adds port to host unless host already names one. A bare IPv6 address
+// gets brackets, since its colons do not mark a port.
+func hostWithPort(host, port string) string {
+	if host == "" {
+		return host
+	}
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), port)
+}
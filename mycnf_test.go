@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestHostWithPort(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"db.internal", "db.internal:3307"},
+		{"db.internal:3306", "db.internal:3306"},
+		{"10.0.0.5:3306", "10.0.0.5:3306"},
+		{"::1", "[::1]:3307"},
+		{"[::1]", "[::1]:3307"},
+		{"[::1]:3306", "[::1]:3306"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := hostWithPort(tt.host, "3307"); got != tt.want {
+			t.Errorf("hostWithPort(%q) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestReadOptionFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]string
+	}{
+		{"client", "[client]\nhost=db\nuser = app\npassword=\"s3cret\"\nport=3307\n", map[string]string{"host": "db", "user": "app", "password": "s3cret", "port": "3307"}},
+		{"empty password", "[client]\npassword=\n", map[string]string{"password": ""}},
+		// A password option without a value asks for the password
+		{"bare password", "[client]\nuser=app\npassword\n", map[string]string{"user": "app"}},
+		{"group overrides client", "[client]\nuser=app\npassword=a\n[migrate]\nuser=migrator\npassword=b\n", map[string]string{"user": "migrator", "password": "b"}},
+		{"bare password in group", "[client]\npassword=a\n[migrate]\npassword\n", map[string]string{}},
+		{"group password after bare client", "[client]\npassword\n[migrate]\npassword=b\n", map[string]string{"password": "b"}},
+		{"other groups ignored", "[mysqld]\nport=3306\n[client]\n# comment\nhost=db\n", map[string]string{"host": "db"}},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "my.cnf")
+		if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		got, err := readOptionFile(path, "migrate")
+		if err != nil {
+			t.Fatalf("%s: readOptionFile() error = %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: readOptionFile() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// promptPassword asks for the database password on the terminal without echoing it.
+// It reports false without prompting when stdin is not a terminal, so scripted runs
+// never block waiting for input.
+func promptPassword(user string, hosts []string) (string, bool, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", false, nil
+	}
+
+	target := ""
+	for i, host := range hosts {
+		if i > 0 {
+			target += " and "
+		}
+		target += user + "@" + host
+	}
+	fmt.Fprintf(os.Stderr, "Enter password for %s: ", target)
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read password: %v", err)
+	}
+	return string(password), true, nil
+}
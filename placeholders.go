@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SQL dialects with their own bind parameter syntax
+const (
+	dialectMySQL    = "mysql"    // ?, ?, ?
+	dialectPostgres = "postgres" // $1, $2, $3
+)
+
+// placeholder returns the bind parameter for the 1-based position in the dialect
+func placeholder(dialect string, position int) string {
+	if dialect == dialectPostgres {
+		return fmt.Sprintf("$%d", position)
+	}
+	return "?"
+}
+
+// placeholders returns n comma-separated bind parameters for the dialect
+func placeholders(dialect string, n int) string {
+	params := make([]string, n)
+	for i := range params {
+		params[i] = placeholder(dialect, i+1)
+	}
+	return strings.Join(params, ", ")
+}
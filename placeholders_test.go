@@ -0,0 +1,62 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlaceholders(t *testing.T) {
+	tests := []struct {
+		dialect string
+		n       int
+		want    string
+	}{
+		{dialectMySQL, 0, ""},
+		{dialectMySQL, 1, "?"},
+		{dialectMySQL, 3, "?, ?, ?"},
+		{dialectPostgres, 1, "$1"},
+		{dialectPostgres, 3, "$1, $2, $3"},
+	}
+	for _, tt := range tests {
+		if got := placeholders(tt.dialect, tt.n); got != tt.want {
+			t.Errorf("placeholders(%q, %d) = %q, want %q", tt.dialect, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestPlaceholder(t *testing.T) {
+	tests := []struct {
+		dialect  string
+		position int
+		want     string
+	}{
+		{dialectMySQL, 1, "?"},
+		{dialectMySQL, 3, "?"},
+		{dialectPostgres, 1, "$1"},
+		{dialectPostgres, 3, "$3"},
+	}
+	for _, tt := range tests {
+		if got := placeholder(tt.dialect, tt.position); got != tt.want {
+			t.Errorf("placeholder(%q, %d) = %q, want %q", tt.dialect, tt.position, got, tt.want)
+		}
+	}
+}
+
+func TestInsertPlaceholders(t *testing.T) {
+	typeNames := []string{"INT", "GEOMETRY", "VARCHAR"}
+	tests := []struct {
+		dialect string
+		want    []string
+	}{
+		{dialectMySQL, []string{"?", "ST_GeomFromWKB(?, ?)", "?"}},
+		{dialectPostgres, []string{"$1", "ST_GeomFromWKB($2, $3)", "$4"}},
+	}
+	for _, tt := range tests {
+		if got := insertPlaceholders(tt.dialect, typeNames); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("insertPlaceholders(%q, %v) = %q, want %q", tt.dialect, typeNames, got, tt.want)
+		}
+	}
+	if got := insertArgCount(typeNames); got != 4 {
+		t.Errorf("insertArgCount(%v) = %d, want 4", typeNames, got)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// privilegeAliases lists other names servers use for a privilege, MariaDB 10.5
+// renamed REPLICATION CLIENT to BINLOG MONITOR
+var privilegeAliases = map[string][]string{
+	"REPLICATION CLIENT": {"BINLOG MONITOR"},
+}
+
+// grantPattern matches a privilege grant line of SHOW GRANTS; role grants have no ON
+var grantPattern = regexp.MustCompile(`^GRANT (.+?) ON (?:TABLE |PROCEDURE |FUNCTION )?(\S+) TO `)
+
+// grant is the set of privileges granted on one database and table scope, where
+// "*" stands for all databases or all tables
+type grant struct {
+	database   *regexp.Regexp
+	table      string
+	privileges map[string]bool
+}
+
+// privilegeCheck is a privilege an enabled feature needs on one table, or on the
+// database for an empty table, or globally for an empty database
+type privilegeCheck struct {
+	privilege string
+	database  string
+	table     string
+	reason    string
+}
+
+func (c privilegeCheck) String() string {
+	scope := "*.*"
+	switch {
+	case c.table != "":
+		scope = fmt.Sprintf("`%s`.`%s`", c.database, c.table)
+	case c.database != "":
+		scope = fmt.Sprintf("`%s`.*", c.database)
+	}
+	return fmt.Sprintf("%s on %s (%s)", c.privilege, scope, c.reason)
+}
+
+// getGrants parses SHOW GRANTS of the connected account. It also reports whether the
+// account was granted roles, whose privileges are not listed.
+func getGrants(db *sql.DB) ([]grant, bool, error) {
+	rows, err := db.Query("SHOW GRANTS")
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to query grants: %v", err)
+	}
+	defer rows.Close()
+
+	var grants []grant
+	hasRoles := false
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return nil, false, fmt.Errorf("failed to scan grant: %v", err)
+		}
+		match := grantPattern.FindStringSubmatch(line)
+		if match == nil {
+			hasRoles = hasRoles || strings.HasPrefix(line, "GRANT ")
+			continue
+		}
+		database, table, _ := strings.Cut(match[2], ".")
+		g := grant{database: grantDatabasePattern(database), table: strings.Trim(table, "`"), privileges: make(map[string]bool)}
+		for _, privilege := range strings.Split(match[1], ",") {
+			// Column privileges do not cover whole rows
+			privilege = strings.ToUpper(strings.TrimSpace(privilege))
+			if !strings.Contains(privilege, "(") {
+				g.privileges[privilege] = true
+			}
+		}
+		grants = append(grants, g)
+	}
+	return grants, hasRoles, rows.Err()
+}
+
+// grantDatabasePattern turns the database of a grant into a regexp: `%` and `_` are
+// wildcards unless escaped with a backslash, and * matches every database
+func grantDatabasePattern(database string) *regexp.Regexp {
+	database = strings.Trim(database, "`")
+	if database == "*" {
+		return regexp.MustCompile(".*")
+	}
+	var pattern strings.Builder
+	for i := 0; i < len(database); i++ {
+		switch c := database[i]; {
+		case c == '\\' && i+1 < len(database):
+			i++
+			pattern.WriteString(regexp.QuoteMeta(database[i : i+1]))
+		case c == '%':
+			pattern.WriteString(".*")
+		case c == '_':
+			pattern.WriteString(".")
+		default:
+			pattern.WriteString(regexp.QuoteMeta(database[i : i+1]))
+		}
+	}
+	return regexp.MustCompile("^" + pattern.String() + "$")
+}
+
+// covers reports whether a grant gives the privilege for the checked scope. Global
+// privileges only come from *.* grants.
+func (g grant) covers(check privilegeCheck) bool {
+	if !g.privileges["ALL"] && !g.privileges["ALL PRIVILEGES"] && !g.privileges[check.privilege] {
+		found := false
+		for _, alias := range privilegeAliases[check.privilege] {
+			found = found || g.privileges[alias]
+		}
+		if !found {
+			return false
+		}
+	}
+	if check.database == "" {
+		return g.database.String() == ".*" && g.table == "*"
+	}
+	if !g.database.MatchString(check.database) {
+		return false
+	}
+	return g.table == "*" || (check.table != "" && g.table == check.table)
+}
+
+// missingPrivileges returns the checks none of the account's grants cover, and
+// whether the account has roles that may grant them after all
+func missingPrivileges(db *sql.DB, checks []privilegeCheck) ([]privilegeCheck, bool, error) {
+	grants, hasRoles, err := getGrants(db)
+	if err != nil {
+		return nil, false, err
+	}
+	var missing []privilegeCheck
+	for _, check := range checks {
+		covered := false
+		for _, g := range grants {
+			covered = covered || g.covers(check)
+		}
+		if !covered {
+			missing = append(missing, check)
+		}
+	}
+	return missing, hasRoles, nil
+}
+
+// tableCheck checks a privilege on a table of database, or of its own database when
+// the table name is qualified
+func tableCheck(privilege, database, table, reason string) privilegeCheck {
+	if qualified, name := splitTableName(table); qualified != nil {
+		database, table = qualified.(string), name
+	}
+	return privilegeCheck{privilege, database, table, reason}
+}
+
+// migrationPrivilegeChecks lists the privileges a migration of the tables needs with
+// the given options on each side
+func migrationPrivilegeChecks(sourceDB, destDB string, tables []tablePair, opts migrationOptions, needsBinlog, readsDest bool) (source, dest []privilegeCheck) {
+	if opts.sourceQuery != "" {
+		source = append(source, privilegeCheck{"SELECT", sourceDB, "", "run -sourceQuery"})
+	}
+	if needsBinlog {
+		source = append(source, privilegeCheck{"REPLICATION CLIENT", "", "", "capture the binlog position"})
+	}
+
+	for _, table := range tables {
+		if opts.sourceQuery == "" {
+			source = append(source, tableCheck("SELECT", sourceDB, table.source, "read source rows"))
+		}
+		destTable := func(privilege, reason string) {
+			dest = append(dest, tableCheck(privilege, destDB, table.dest, reason))
+		}
+		destTable("CREATE", "create the destination table")
+		destTable("INSERT", "insert rows")
+		if opts.onConflict == "replace" {
+			destTable("DELETE", "replace existing rows")
+		}
+		if opts.disableKeys {
+			destTable("ALTER", "disable keys during the load")
+			destTable("INDEX", "rebuild indexes after the load")
+		}
+		if readsDest {
+			destTable("SELECT", "read destination rows")
+		}
+	}
+	if opts.deadLetterTable != "" {
+		dest = append(dest,
+			tableCheck("CREATE", destDB, opts.deadLetterTable, "create the dead-letter table"),
+			tableCheck("INSERT", destDB, opts.deadLetterTable, "record failed rows"))
+	}
+	// Staging tables do not exist yet, so their privileges must cover the database
+	if opts.stagingSwap {
+		dest = append(dest,
+			privilegeCheck{"CREATE", destDB, "", "create staging tables"},
+			privilegeCheck{"INSERT", destDB, "", "fill staging tables"},
+			privilegeCheck{"ALTER", destDB, "", "rename staging tables"},
+			privilegeCheck{"DROP", destDB, "", "swap out the old tables"})
+	}
+	return source, dest
+}
+
+// preflightPrivileges reports the privileges the source and destination accounts lack
+// for the migration and whether all are present. Missing privileges that roles may
+// grant are reported as warnings only.
+func preflightPrivileges(srcDB, dstDB *sql.DB, sourceChecks, destChecks []privilegeCheck) (bool, error) {
+	passed := true
+	for _, side := range []struct {
+		db     *sql.DB
+		name   string
+		checks []privilegeCheck
+	}{{srcDB, "source", sourceChecks}, {dstDB, "destination", destChecks}} {
+		missing, hasRoles, err := missingPrivileges(side.db, side.checks)
+		if err != nil {
+			return false, fmt.Errorf("%s: %v", side.name, err)
+		}
+		if len(missing) == 0 {
+			continue
+		}
+		if hasRoles {
+			log.Printf("Warning: the %s account has roles, which may grant these privileges:\n", side.name)
+		} else {
+			fmt.Printf("Missing %s privileges:\n", side.name)
+			passed = false
+		}
+		for _, check := range missing {
+			fmt.Printf("  - %s\n", check)
+		}
+	}
+	return passed, nil
+}
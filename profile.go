@@ -0,0 +1,95 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// columnKind classifies a column type for profiling: numeric columns get min/max,
+// text columns an empty-string count, and large objects no distinct count
+func columnKind(columnType string) (numeric, text, large bool) {
+	baseType := strings.ToLower(columnType)
+	if i := strings.IndexAny(baseType, "( "); i >= 0 {
+		baseType = baseType[:i]
+	}
+	switch baseType {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint", "decimal", "numeric", "float", "double", "real":
+		return true, false, false
+	case "char", "varchar", "enum", "set":
+		return false, true, false
+	case "tinytext", "text", "mediumtext", "longtext":
+		return false, true, true
+	case "tinyblob", "blob", "mediumblob", "longblob", "json", "geometry", "point", "linestring", "polygon",
+		"multipoint", "multilinestring", "multipolygon", "geometrycollection":
+		return false, false, true
+	}
+	return false, false, false
+}
+
+// profileTable prints per-column statistics of the source rows selected by condition:
+// NULL and empty string counts, min/max of numeric columns and the number of distinct
+// values. All are computed by one aggregate query; large object columns are not
+// counted distinct since that would sort every value.
+func profileTable(srcDB *sql.DB, table, condition string) error {
+	columns, err := getColumns(srcDB, table)
+	if err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("source table '%s' does not exist", table)
+	}
+
+	aggregates := []string{"COUNT(*)"}
+	for _, column := range columns {
+		quoted := fmt.Sprintf("`%s`", column.name)
+		numeric, text, large := columnKind(column.columnType)
+		aggregates = append(aggregates, fmt.Sprintf("SUM(%s IS NULL)", quoted))
+		if text {
+			aggregates = append(aggregates, fmt.Sprintf("SUM(%s = '')", quoted))
+		}
+		if numeric {
+			aggregates = append(aggregates, fmt.Sprintf("MIN(%s)", quoted), fmt.Sprintf("MAX(%s)", quoted))
+		}
+		if !large {
+			aggregates = append(aggregates, fmt.Sprintf("COUNT(DISTINCT %s)", quoted))
+		}
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s%s", strings.Join(aggregates, ", "), table, whereClause(condition))
+	values := make([]sql.NullString, len(aggregates))
+	pointers := make([]interface{}, len(values))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if err := srcDB.QueryRow(query).Scan(pointers...); err != nil {
+		return fmt.Errorf("error profiling source table: %v", err)
+	}
+
+	// Aggregates over no rows are NULL
+	next := 1
+	value := func() string {
+		v := values[next]
+		next++
+		if !v.Valid {
+			return "-"
+		}
+		return v.String
+	}
+	fmt.Printf("Profile of '%s' (%s rows):\n", table, values[0].String)
+	for _, column := range columns {
+		numeric, text, large := columnKind(column.columnType)
+		stats := []string{"nulls=" + value()}
+		if text {
+			stats = append(stats, "empty="+value())
+		}
+		if numeric {
+			stats = append(stats, "min="+value(), "max="+value())
+		}
+		if !large {
+			stats = append(stats, "distinct="+value())
+		}
+		fmt.Printf("  %s (%s): %s\n", column.name, column.columnType, strings.Join(stats, " "))
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+)
+
+// progressEventInterval is how many rows are migrated between progress events
+const progressEventInterval = 1000
+
+// progressEvent is one line of the -progressJSON stream
+type progressEvent struct {
+	Event    string `json:"event"`
+	Table    string `json:"table,omitempty"`
+	Migrated int64  `json:"migrated"`
+	Failed   int64  `json:"failed,omitempty"`
+	Total    int64  `json:"total,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// progressEmitter writes newline-delimited JSON progress events for a wrapper process.
+// A nil emitter discards events, so callers need not check whether -progressJSON is set.
+type progressEmitter struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+func newProgressEmitter(w io.Writer) *progressEmitter {
+	return &progressEmitter{encoder: json.NewEncoder(w)}
+}
+
+func (p *progressEmitter) emit(event progressEvent) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.encoder.Encode(event); err != nil {
+		log.Printf("Error writing progress event: %v\n", err)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// sourceQueryLabel names the source in messages when copying from -sourceQuery
+const sourceQueryLabel = "sourceQuery"
+
+// readOnlyQueryPattern matches statements that start as a plain read
+var readOnlyQueryPattern = regexp.MustCompile(`(?is)^(select|with)\s`)
+
+// validateSourceQuery checks that query is a single SELECT statement and returns it
+// without a trailing semicolon. Writes would also be refused by the read-only source
+// transaction, this only catches mistakes early.
+func validateSourceQuery(query string) (string, error) {
+	query = strings.TrimSuffix(strings.TrimSpace(query), ";")
+	if strings.Contains(query, ";") {
+		return "", fmt.Errorf("-sourceQuery must be a single statement")
+	}
+	if !readOnlyQueryPattern.MatchString(query) {
+		return "", fmt.Errorf("-sourceQuery must be a SELECT statement")
+	}
+	if strings.Contains(strings.ToUpper(query), " FOR UPDATE") {
+		return "", fmt.Errorf("-sourceQuery must not lock rows")
+	}
+	return query, nil
+}
+
+// sourceQueryFrom wraps a query so it can stand in for a table name in a FROM clause
+func sourceQueryFrom(query string) string {
+	return fmt.Sprintf("(%s) AS source_query", query)
+}
+
+// createTableFromQuery creates the destination table from the result column types of
+// query if it does not exist, reporting whether it was created. The driver does not
+// report string lengths, so strings and binary values get LONGTEXT and LONGBLOB;
+// create the table beforehand for exact types.
+func createTableFromQuery(srcDB, destDB *sql.DB, query, destTableName string) (bool, error) {
+	exists, err := tableExists(destDB, destTableName)
+	if err != nil {
+		return false, fmt.Errorf("error checking table existence: %v", err)
+	}
+	if exists {
+		progressf("Table '%s' already exists\n", destTableName)
+		return false, nil
+	}
+
+	rows, err := srcDB.Query(fmt.Sprintf("SELECT * FROM %s LIMIT 0", sourceQueryFrom(query)))
+	if err != nil {
+		return false, fmt.Errorf("failed to run source query: %v", err)
+	}
+	defer rows.Close()
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return false, fmt.Errorf("failed to get source query column types: %v", err)
+	}
+	if len(columnTypes) == 0 {
+		return false, fmt.Errorf("source query returned no columns")
+	}
+
+	columns := make([]string, len(columnTypes))
+	for i, columnType := range columnTypes {
+		columns[i] = fmt.Sprintf("`%s` %s", columnType.Name(), queryColumnType(columnType))
+		if nullable, ok := columnType.Nullable(); ok && !nullable {
+			columns[i] += " NOT NULL"
+		}
+	}
+	createTableSQL := fmt.Sprintf("CREATE TABLE %s (%s)", destTableName, strings.Join(columns, ", "))
+	if _, err := destDB.Exec(createTableSQL); err != nil {
+		return false, fmt.Errorf("failed to create table: %v\ngenerated statement: %s", err, createTableSQL)
+	}
+	progressf("Table '%s' created successfully\n", destTableName)
+	return true, nil
+}
+
+// queryColumnType maps a result column type to a column type for CREATE TABLE
+func queryColumnType(columnType *sql.ColumnType) string {
+	typeName := columnType.DatabaseTypeName()
+	switch typeName {
+	case "CHAR", "VARCHAR", "TEXT", "ENUM", "SET":
+		return "LONGTEXT"
+	case "BINARY", "VARBINARY", "BLOB":
+		return "LONGBLOB"
+	case "DECIMAL":
+		if precision, scale, ok := columnType.DecimalSize(); ok {
+			return fmt.Sprintf("DECIMAL(%d,%d)", precision, scale)
+		}
+		return "DECIMAL(65,30)"
+	case "BIT":
+		return "BIT(64)"
+	}
+	if unsigned := strings.TrimPrefix(typeName, "UNSIGNED "); unsigned != typeName {
+		return unsigned + " UNSIGNED"
+	}
+	return typeName
+}
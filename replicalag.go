@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// replicaLagCheckInterval is how often the replica lag is measured
+const replicaLagCheckInterval = time.Second
+
+// lagThrottle pauses the copy while a monitored replica lags too far behind
+type lagThrottle struct {
+	lagging atomic.Bool
+}
+
+// wait blocks while the replica lags, until it catches up or ctx is cancelled.
+// A nil throttle never waits.
+func (t *lagThrottle) wait(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	for t.lagging.Load() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(replicaLagCheckInterval):
+		}
+	}
+	return nil
+}
+
+// startReplicaLagMonitor measures the lag of replicaDB every replicaLagCheckInterval and
+// throttles the copy while it exceeds maxLag. lagQuery must return the lag in seconds
+// as its first column; when empty, Seconds_Behind_Master of SHOW SLAVE STATUS is used.
+// The returned stop function ends the monitor and waits for its goroutine to exit.
+func startReplicaLagMonitor(ctx context.Context, replicaDB *sql.DB, lagQuery string, maxLag time.Duration) (*lagThrottle, func()) {
+	throttle := &lagThrottle{}
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(replicaLagCheckInterval)
+		defer ticker.Stop()
+		for {
+			lag, err := measureReplicaLag(ctx, replicaDB, lagQuery)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Warning: replica lag check failed: %v\n", err)
+			}
+			// An unknown lag, such as stopped replication, throttles like a large one
+			lagging := err != nil || lag > maxLag
+			if lagging != throttle.lagging.Load() && ctx.Err() == nil {
+				if lagging {
+					log.Printf("Replica lag %s exceeds %s, pausing inserts\n", describeLag(lag, err), maxLag)
+				} else {
+					log.Printf("Replica lag down to %s, resuming inserts\n", lag)
+				}
+			}
+			throttle.lagging.Store(lagging)
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				throttle.lagging.Store(false)
+				return
+			}
+		}
+	}()
+
+	return throttle, func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+func describeLag(lag time.Duration, err error) string {
+	if err != nil {
+		return "unknown"
+	}
+	return lag.String()
+}
+
+// measureReplicaLag runs lagQuery, or SHOW SLAVE STATUS when it is empty, and returns
+// the replica lag. A NULL lag, meaning replication is not running, is an error.
+func measureReplicaLag(ctx context.Context, db *sql.DB, lagQuery string) (time.Duration, error) {
+	if lagQuery != "" {
+		var seconds sql.NullFloat64
+		if err := db.QueryRowContext(ctx, lagQuery).Scan(&seconds); err != nil {
+			return 0, err
+		}
+		if !seconds.Valid {
+			return 0, fmt.Errorf("lag query returned NULL")
+		}
+		return time.Duration(seconds.Float64 * float64(time.Second)), nil
+	}
+
+	rows, err := db.QueryContext(ctx, "SHOW SLAVE STATUS")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+		return 0, fmt.Errorf("server is not a replica")
+	}
+	values := make([]sql.NullString, len(cols))
+	pointers := make([]interface{}, len(cols))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if err := rows.Scan(pointers...); err != nil {
+		return 0, err
+	}
+	for i, col := range cols {
+		if col != "Seconds_Behind_Master" {
+			continue
+		}
+		if !values[i].Valid {
+			return 0, fmt.Errorf("replication is not running")
+		}
+		seconds, err := strconv.ParseInt(values[i].String, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("unexpected Seconds_Behind_Master '%s'", values[i].String)
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return 0, fmt.Errorf("SHOW SLAVE STATUS has no Seconds_Behind_Master column")
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// tableReport is the result of one table in the -reportFormat json and table reports
+type tableReport struct {
+	Source   string  `json:"source"`
+	Dest     string  `json:"dest"`
+	Created  bool    `json:"created"`
+	Migrated int     `json:"migrated"`
+	Failed   int     `json:"failed"`
+	Duration float64 `json:"durationSeconds"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// report describes the result of migrating table, which failed with err when set
+func (r tableResult) report(table tablePair, err error) tableReport {
+	report := tableReport{
+		Source:   table.source,
+		Dest:     table.dest,
+		Created:  r.created,
+		Migrated: r.migrated,
+		Failed:   r.failed,
+		Duration: r.duration.Seconds(),
+	}
+	if err != nil {
+		report.Error = err.Error()
+	}
+	return report
+}
+
+// writeReport writes the final report of a run in format json or table. The text
+// format has no final report beyond the output printed while migrating.
+func writeReport(w io.Writer, format string, reports []tableReport) error {
+	total := 0
+	for _, report := range reports {
+		total += report.Migrated
+	}
+
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(struct {
+			Tables   []tableReport `json:"tables"`
+			Migrated int           `json:"migrated"`
+		}{reports, total})
+	case "table":
+		grid := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(grid, "TABLE\tROWS\tFAILED\tDURATION\tSTATUS")
+		for _, report := range reports {
+			status := "ok"
+			if report.Error != "" {
+				status = "error"
+			}
+			fmt.Fprintf(grid, "%s\t%d\t%d\t%.1fs\t%s\n", report.Source, report.Migrated, report.Failed, report.Duration, status)
+		}
+		fmt.Fprintf(grid, "total\t%d\t\t\t\n", total)
+		return grid.Flush()
+	}
+	return nil
+}
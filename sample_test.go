@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+)
+
+// sampleSource answers the primary key, column and sample queries of verifySampleTable
+// for a forms table of id, status and secret columns
+func sampleSource(rows [][]driver.Value) *fakeDB {
+	return &fakeDB{query: func(query string, _ []driver.Value) *fakeRows {
+		switch {
+		case strings.Contains(query, "information_schema.statistics"):
+			return &fakeRows{cols: []string{"column_name"}, rows: [][]driver.Value{{"id"}}}
+		case strings.Contains(query, "information_schema.columns"):
+			columns := &fakeRows{cols: []string{"column_name", "column_type", "is_nullable", "column_default", "extra", "collation_name", "column_comment"}}
+			for _, name := range []string{"id", "status", "secret"} {
+				columns.rows = append(columns.rows, []driver.Value{name, "int", "NO", nil, "", nil, ""})
+			}
+			return columns
+		case strings.Contains(query, "ORDER BY RAND()"):
+			return &fakeRows{cols: []string{"id", "status"}, typeNames: []string{"INT", "INT"}, rows: rows}
+		}
+		return nil
+	}}
+}
+
+func TestVerifySampleTableFiltered(t *testing.T) {
+	// Only the filtered row 1 was copied, and its secret column was encrypted
+	src := sampleSource([][]driver.Value{{int64(1), int64(1)}})
+	dst := &fakeDB{query: func(_ string, args []driver.Value) *fakeRows {
+		if args[0] == int64(1) {
+			return &fakeRows{cols: []string{"id", "status"}, typeNames: []string{"INT", "INT"}, rows: [][]driver.Value{{int64(1), int64(1)}}}
+		}
+		return nil
+	}}
+	matched, mismatched, err := verifySampleTable(context.Background(), openFake(t, src), openFake(t, dst), tablePair{"forms", "forms"}, 5, "status = 1", map[string]bool{"secret": true})
+	if err != nil {
+		t.Fatalf("verifySampleTable() error = %v", err)
+	}
+	if matched != 1 || mismatched != 0 {
+		t.Errorf("verifySampleTable() = %d matched, %d mismatched, want 1 matched", matched, mismatched)
+	}
+	if want := "SELECT `id`, `status` FROM forms WHERE status = 1 ORDER BY RAND() LIMIT 5"; !src.ran(want) {
+		t.Errorf("sample query not run with the filter and without the skipped column, ran %q", src.statements)
+	}
+	if want := "SELECT `id`, `status` FROM forms WHERE `id` = ?"; !dst.ran(want) {
+		t.Errorf("destination lookup not run without the skipped column, ran %q", dst.statements)
+	}
+}
+
+func TestVerifySampleTableSkippedKey(t *testing.T) {
+	src := sampleSource(nil)
+	_, _, err := verifySampleTable(context.Background(), openFake(t, src), openFake(t, &fakeDB{}), tablePair{"forms", "forms"}, 5, "", map[string]bool{"id": true})
+	if err == nil || !strings.Contains(err.Error(), "'id'") {
+		t.Errorf("verifySampleTable() with a skipped key error = %v, want one naming column 'id'", err)
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// diffColumns describes how the columns of two tables differ, by column name
+func diffColumns(srcColumns, destColumns []columnInfo, destServer serverInfo) []string {
+	var diffs []string
+	destByName := make(map[string]columnInfo, len(destColumns))
+	for _, column := range destColumns {
+		destByName[column.name] = column
+	}
+	srcNames := make(map[string]bool, len(srcColumns))
+
+	for _, src := range srcColumns {
+		srcNames[src.name] = true
+		dest, ok := destByName[src.name]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("column '%s' only in source", src.name))
+			continue
+		}
+		attribute := func(name, srcValue, destValue string) {
+			if srcValue != destValue {
+				diffs = append(diffs, fmt.Sprintf("column '%s' %s: %s in source, %s in destination", src.name, name, srcValue, destValue))
+			}
+		}
+		attribute("type", src.columnType, dest.columnType)
+		attribute("nullability", nullability(src.nullable), nullability(dest.nullable))
+		attribute("default", describeDefault(src.defaultValue), describeDefault(dest.defaultValue))
+		attribute("extra", describeExtra(src.extra), describeExtra(dest.extra))
+		if src.collation.Valid && dest.collation.Valid && !collationsCompatible(src.collation.String, dest.collation.String, destServer) {
+			attribute("collation", src.collation.String, dest.collation.String)
+		}
+		attribute("comment", quoteLiteral(src.comment), quoteLiteral(dest.comment))
+	}
+	for _, dest := range destColumns {
+		if !srcNames[dest.name] {
+			diffs = append(diffs, fmt.Sprintf("column '%s' only in destination", dest.name))
+		}
+	}
+	return diffs
+}
+
+func nullability(nullable bool) string {
+	if nullable {
+		return "NULL"
+	}
+	return "NOT NULL"
+}
+
+func describeDefault(value sql.NullString) string {
+	if !value.Valid {
+		return "no default"
+	}
+	return quoteLiteral(value.String)
+}
+
+func describeExtra(extra string) string {
+	if extra == "" {
+		return "none"
+	}
+	return extra
+}
+
+// diffDefinitions describes the named definitions present on one side only or
+// defined differently on each side, in name order
+func diffDefinitions(kind string, src, dest map[string]string) []string {
+	names := make([]string, 0, len(src)+len(dest))
+	for name := range src {
+		names = append(names, name)
+	}
+	for name := range dest {
+		if _, ok := src[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var diffs []string
+	for _, name := range names {
+		srcDef, inSource := src[name]
+		destDef, inDest := dest[name]
+		switch {
+		case !inDest:
+			diffs = append(diffs, fmt.Sprintf("%s '%s' only in source: %s", kind, name, srcDef))
+		case !inSource:
+			diffs = append(diffs, fmt.Sprintf("%s '%s' only in destination: %s", kind, name, destDef))
+		case srcDef != destDef:
+			diffs = append(diffs, fmt.Sprintf("%s '%s' differs: %s in source, %s in destination", kind, name, srcDef, destDef))
+		}
+	}
+	return diffs
+}
+
+// indexDefinitions returns the secondary indexes of a table rendered as DDL, by name
+func indexDefinitions(db *sql.DB, table string) (map[string]string, error) {
+	indexes, err := getIndexes(db, table)
+	if err != nil {
+		return nil, err
+	}
+	definitions := make(map[string]string, len(indexes))
+	for _, index := range indexes {
+		definitions[index.name] = indexDefinition(index)
+	}
+
+	keyColumns, err := getPrimaryKeyColumns(db, table)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching primary key: %v", err)
+	}
+	if len(keyColumns) > 0 {
+		definitions["PRIMARY"] = fmt.Sprintf("PRIMARY KEY (`%s`)", strings.Join(keyColumns, "`, `"))
+	}
+	return definitions, nil
+}
+
+// foreignKeyDefinitions returns the foreign keys of a table, by name. The referenced
+// schema is left out since source and destination live in different databases.
+func foreignKeyDefinitions(db *sql.DB, table string) (map[string]string, error) {
+	keys, err := getForeignKeys(db, table)
+	if err != nil {
+		return nil, err
+	}
+	definitions := make(map[string]string, len(keys))
+	for _, key := range keys {
+		definitions[key.name] = fmt.Sprintf("(`%s`) REFERENCES `%s` (`%s`)",
+			strings.Join(key.columns, "`, `"), key.referencedTable, strings.Join(key.referencedCols, "`, `"))
+	}
+	return definitions, nil
+}
+
+// diffTableSchema lists the structural differences between the source and
+// destination table: columns and their attributes, indexes and foreign keys
+func diffTableSchema(srcDB, dstDB *sql.DB, table tablePair, destServer serverInfo) ([]string, error) {
+	for _, side := range []struct {
+		db    *sql.DB
+		table string
+		name  string
+	}{{srcDB, table.source, "source"}, {dstDB, table.dest, "destination"}} {
+		exists, err := tableExists(side.db, side.table)
+		if err != nil {
+			return nil, fmt.Errorf("error checking %s table existence: %v", side.name, err)
+		}
+		if !exists {
+			return []string{fmt.Sprintf("%s table '%s' does not exist", side.name, side.table)}, nil
+		}
+	}
+
+	srcColumns, err := getColumns(srcDB, table.source)
+	if err != nil {
+		return nil, err
+	}
+	destColumns, err := getColumns(dstDB, table.dest)
+	if err != nil {
+		return nil, err
+	}
+	diffs := diffColumns(srcColumns, destColumns, destServer)
+
+	srcIndexes, err := indexDefinitions(srcDB, table.source)
+	if err != nil {
+		return nil, err
+	}
+	destIndexes, err := indexDefinitions(dstDB, table.dest)
+	if err != nil {
+		return nil, err
+	}
+	diffs = append(diffs, diffDefinitions("index", srcIndexes, destIndexes)...)
+
+	srcKeys, err := foreignKeyDefinitions(srcDB, table.source)
+	if err != nil {
+		return nil, err
+	}
+	destKeys, err := foreignKeyDefinitions(dstDB, table.dest)
+	if err != nil {
+		return nil, err
+	}
+	diffs = append(diffs, diffDefinitions("foreign key", srcKeys, destKeys)...)
+	return diffs, nil
+}
+
+// schemaDiff prints the structural differences of every table pair and reports
+// whether all tables have the same structure on both sides
+func schemaDiff(srcDB, dstDB *sql.DB, tables []tablePair) (bool, error) {
+	destServer, err := detectServer(dstDB)
+	if err != nil {
+		return false, err
+	}
+
+	identical := 0
+	for _, table := range tables {
+		diffs, err := diffTableSchema(srcDB, dstDB, table, destServer)
+		if err != nil {
+			return false, fmt.Errorf("table '%s': %v", table.source, err)
+		}
+		if len(diffs) == 0 {
+			fmt.Printf("SAME %s -> %s\n", table.source, table.dest)
+			identical++
+			continue
+		}
+		fmt.Printf("DIFF %s -> %s\n", table.source, table.dest)
+		for _, diff := range diffs {
+			fmt.Printf("  - %s\n", diff)
+		}
+	}
+
+	fmt.Printf("Schema diff: %d of %d tables identical\n", identical, len(tables))
+	return identical == len(tables), nil
+}
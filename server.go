@@ -0,0 +1,190 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// serverInfo describes the flavor and version of a database server
+type serverInfo struct {
+	version string
+	mariaDB bool
+	major   int
+	minor   int
+}
+
+func (s serverInfo) String() string {
+	if s.mariaDB {
+		return fmt.Sprintf("MariaDB %s", s.version)
+	}
+	return fmt.Sprintf("MySQL %s", s.version)
+}
+
+// atLeast reports whether the server version is major.minor or newer
+func (s serverInfo) atLeast(major, minor int) bool {
+	return s.major > major || (s.major == major && s.minor >= minor)
+}
+
+// detectServer queries the server version to tell MySQL and MariaDB apart
+func detectServer(db *sql.DB) (serverInfo, error) {
+	var version string
+	if err := db.QueryRow("SELECT VERSION()").Scan(&version); err != nil {
+		return serverInfo{}, fmt.Errorf("failed to query server version: %v", err)
+	}
+
+	info := serverInfo{version: version, mariaDB: strings.Contains(strings.ToLower(version), "mariadb")}
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) >= 2 {
+		info.major, _ = strconv.Atoi(parts[0])
+		info.minor, _ = strconv.Atoi(parts[1])
+	}
+	return info, nil
+}
+
+// currentTimestampPattern matches the MySQL (CURRENT_TIMESTAMP) and MariaDB
+// (current_timestamp()) spellings of the timestamp default, with optional precision
+var currentTimestampPattern = regexp.MustCompile(`(?i)current_timestamp(?:\((\d*)\))?`)
+
+// normalizeCurrentTimestamp rewrites every CURRENT_TIMESTAMP spelling in s into the
+// form accepted by both servers
+func normalizeCurrentTimestamp(s string) string {
+	return currentTimestampPattern.ReplaceAllStringFunc(s, func(match string) string {
+		precision := currentTimestampPattern.FindStringSubmatch(match)[1]
+		if precision == "" {
+			return "CURRENT_TIMESTAMP"
+		}
+		return fmt.Sprintf("CURRENT_TIMESTAMP(%s)", precision)
+	})
+}
+
+// isCurrentTimestamp reports whether a default value is exactly a CURRENT_TIMESTAMP spelling
+func isCurrentTimestamp(value string) bool {
+	match := currentTimestampPattern.FindString(value)
+	return match != "" && len(match) == len(value)
+}
+
+// normalizeCollation maps a source collation to an equivalent one the destination
+// server supports, since MySQL and MariaDB name their utf8 collations differently
+func normalizeCollation(collation string, dest serverInfo) string {
+	if dest.mariaDB {
+		// MySQL 8 UCA 9.0.0 collations do not exist on MariaDB
+		if strings.HasPrefix(collation, "utf8mb4_0900_") {
+			return "utf8mb4_unicode_520_ci"
+		}
+		// MariaDB only understands the utf8mb3 alias from 10.6
+		if strings.HasPrefix(collation, "utf8mb3_") && !dest.atLeast(10, 6) {
+			return "utf8_" + strings.TrimPrefix(collation, "utf8mb3_")
+		}
+		return collation
+	}
+
+	// MariaDB UCA 14.0.0 collations do not exist on MySQL
+	if strings.HasPrefix(collation, "utf8mb4_uca1400_") {
+		if dest.atLeast(8, 0) {
+			return "utf8mb4_0900_ai_ci"
+		}
+		return "utf8mb4_unicode_520_ci"
+	}
+	return collation
+}
+
+// collationsCompatible reports whether a destination column collation is an acceptable
+// match for the source one: the same collation, its utf8/utf8mb3 alias, or the
+// equivalent this tool picks when creating the table on the destination server.
+// Collations that sort or compare differently, such as utf8mb4_general_ci and
+// utf8mb4_0900_ai_ci, are not compatible.
+func collationsCompatible(src, dest string, destServer serverInfo) bool {
+	alias := func(collation string) string {
+		if strings.HasPrefix(collation, "utf8mb3_") {
+			return "utf8_" + strings.TrimPrefix(collation, "utf8mb3_")
+		}
+		return collation
+	}
+	return alias(src) == alias(dest) || alias(normalizeCollation(src, destServer)) == alias(dest)
+}
+
+// collationCharset returns the character set a collation belongs to, which prefixes its name
+func collationCharset(collation string) string {
+	return strings.SplitN(collation, "_", 2)[0]
+}
+
+// checkCollations verifies that the server supports the collations the DDL options name
+func checkCollations(db *sql.DB, ddl ddlOptions) error {
+	var names []string
+	if ddl.collation != "" {
+		names = append(names, ddl.collation)
+	}
+	for _, override := range ddl.columnCollations {
+		names = append(names, override.value)
+	}
+	for _, name := range names {
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM information_schema.collations WHERE collation_name = ?", name).Scan(&count); err != nil {
+			return fmt.Errorf("failed to query collations: %v", err)
+		}
+		if count == 0 {
+			return fmt.Errorf("the destination server does not support collation '%s'", name)
+		}
+	}
+	return nil
+}
+
+// getTableOptions returns the charset, collation and comment clause for recreating the
+// source table on the destination server, with the collation replaced and the comment
+// stamped as the DDL options ask
+func getTableOptions(db *sql.DB, tableName string, ddl ddlOptions, dest serverInfo) (string, error) {
+	var collation sql.NullString
+	var comment string
+	query := "SELECT table_collation, table_comment FROM information_schema.tables WHERE table_schema = COALESCE(?, DATABASE()) AND table_name = ?"
+	schema, table := splitTableName(tableName)
+	if err := db.QueryRow(query, schema, table).Scan(&collation, &comment); err != nil {
+		return "", fmt.Errorf("failed to query table options: %v", err)
+	}
+
+	var options string
+	if ddl.collation != "" {
+		options += fmt.Sprintf(" DEFAULT CHARSET=%s COLLATE=%s", collationCharset(ddl.collation), ddl.collation)
+	} else if collation.Valid && collation.String != "" {
+		normalized := normalizeCollation(collation.String, dest)
+		options += fmt.Sprintf(" DEFAULT CHARSET=%s COLLATE=%s", collationCharset(normalized), normalized)
+	}
+	if ddl.stamp != "" {
+		comment = stampedComment(comment, ddl.stamp, tableName)
+	}
+	if comment != "" {
+		options += " COMMENT=" + quoteLiteral(comment)
+	}
+	return options, nil
+}
+
+// stampPattern matches the -stampComment provenance at the end of a table comment
+var stampPattern = regexp.MustCompile(`(?:; )?migrated by cluster-sync at \S+ from \S+$`)
+
+// stampedComment appends the provenance of a copy from sourceTable to a table comment,
+// replacing the one an earlier run left so repeated runs do not pile them up
+func stampedComment(comment, stamp, sourceTable string) string {
+	comment = stampPattern.ReplaceAllString(comment, "")
+	provenance := fmt.Sprintf("%s from %s", stamp, sourceTable)
+	if comment == "" {
+		return provenance
+	}
+	return comment + "; " + provenance
+}
+
+// stampTableComment sets the -stampComment provenance on an existing destination table
+func stampTableComment(destDB *sql.DB, destTable, sourceTable, stamp string) error {
+	var comment string
+	query := "SELECT table_comment FROM information_schema.tables WHERE table_schema = COALESCE(?, DATABASE()) AND table_name = ?"
+	schema, table := splitTableName(destTable)
+	if err := destDB.QueryRow(query, schema, table).Scan(&comment); err != nil {
+		return fmt.Errorf("failed to query table comment: %v", err)
+	}
+	alter := fmt.Sprintf("ALTER TABLE %s COMMENT = %s", destTable, quoteLiteral(stampedComment(comment, stamp, sourceTable)))
+	if _, err := destDB.Exec(alter); err != nil {
+		return fmt.Errorf("failed to stamp table comment: %v", err)
+	}
+	return nil
+}
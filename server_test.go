@@ -0,0 +1,31 @@
+package main
+
+import (
+	"database/sql/driver"
+	"testing"
+)
+
+func TestGetTableOptions(t *testing.T) {
+	tests := []struct {
+		collation interface{}
+		comment   string
+		want      string
+	}{
+		{"utf8mb4_general_ci", "", " DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci"},
+		{"utf8mb4_general_ci", "user's forms", " DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci COMMENT='user''s forms'"},
+		{nil, "view-like", " COMMENT='view-like'"},
+		{nil, "", ""},
+	}
+	for _, tt := range tests {
+		db := openFake(t, &fakeDB{query: func(string, []driver.Value) *fakeRows {
+			return &fakeRows{cols: []string{"table_collation", "table_comment"}, rows: [][]driver.Value{{tt.collation, tt.comment}}}
+		}})
+		got, err := getTableOptions(db, "forms", ddlOptions{}, serverInfo{version: "8.0.36", major: 8})
+		if err != nil {
+			t.Fatalf("getTableOptions() error = %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("getTableOptions() with collation %v and comment %q = %q, want %q", tt.collation, tt.comment, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+)
+
+// destShard is one destination database of a -destShards migration
+type destShard struct {
+	name string
+	db   *sql.DB
+}
+
+// destinations returns the databases a table is written to: every shard, or dstDB alone
+func destinations(dstDB *sql.DB, opts migrationOptions) []*sql.DB {
+	if len(opts.shards) == 0 {
+		return []*sql.DB{dstDB}
+	}
+	dbs := make([]*sql.DB, len(opts.shards))
+	for i, shard := range opts.shards {
+		dbs[i] = shard.db
+	}
+	return dbs
+}
+
+// shardOf returns the shard of a row: the CRC32 of its primary key modulo the shard
+// count. The key is rendered like MySQL's CONCAT_WS(',', key...), so applications can
+// find a row's shard with CRC32(key) % count for integer and string keys.
+func shardOf(values []interface{}, keyIndexes []int, shardCount int) int {
+	parts := make([]string, len(keyIndexes))
+	for i, index := range keyIndexes {
+		switch v := values[index].(type) {
+		case string:
+			parts[i] = v
+		case []byte:
+			parts[i] = string(v)
+		case int64:
+			parts[i] = strconv.FormatInt(v, 10)
+		case uint64:
+			parts[i] = strconv.FormatUint(v, 10)
+		default:
+			parts[i] = fmt.Sprint(v)
+		}
+	}
+	return int(crc32.ChecksumIEEE([]byte(strings.Join(parts, ","))) % uint32(shardCount))
+}
+
+// joinConditions combines two optional WHERE conditions with AND
+func joinConditions(a, b string) string {
+	switch {
+	case a == "":
+		return b
+	case b == "":
+		return a
+	}
+	return fmt.Sprintf("(%s) AND (%s)", a, b)
+}
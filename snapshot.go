@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Snapshot files are for development and testing only: they let repeated runs against
+// a stable copy of the source skip the source entirely. A snapshot does not follow
+// later source changes or changed filters; use -refreshSnapshot to record it again.
+
+func init() {
+	// Values scanned from the source may hold these types inside interface{}
+	gob.Register(time.Time{})
+}
+
+// snapshotHeader starts a snapshot file, followed by one []interface{} per row
+type snapshotHeader struct {
+	Columns   []string
+	TypeNames []string
+}
+
+// sourceRows yields the rows to migrate, from the live source or a snapshot file
+type sourceRows struct {
+	cols      []string
+	typeNames []string
+
+	// next returns the next row, or io.EOF after the last one. Live sources reuse the
+	// returned slice, so it is only valid until the following call.
+	next func() ([]interface{}, error)
+	// finish completes a fully read source: it commits the source transaction and
+	// keeps a snapshot being recorded
+	finish func() error
+	// close releases the source; after a successful finish it does nothing
+	close func()
+}
+
+// openSnapshot reads the rows of a snapshot file recorded by an earlier run
+func openSnapshot(path string) (*sourceRows, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open snapshot: %v", err)
+	}
+	decoder := gob.NewDecoder(file)
+	var header snapshotHeader
+	if err := decoder.Decode(&header); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read snapshot header: %v", err)
+	}
+
+	return &sourceRows{
+		cols:      header.Columns,
+		typeNames: header.TypeNames,
+		next: func() ([]interface{}, error) {
+			var values []interface{}
+			if err := decoder.Decode(&values); err != nil {
+				if err == io.EOF {
+					return nil, io.EOF
+				}
+				return nil, fmt.Errorf("failed to read snapshot row: %v", err)
+			}
+			// gob drops the elements of an all-NULL row
+			if len(values) < len(header.Columns) {
+				values = append(values, make([]interface{}, len(header.Columns)-len(values))...)
+			}
+			return values, nil
+		},
+		finish: func() error { return nil },
+		close:  func() { file.Close() },
+	}, nil
+}
+
+// queryRows reads the rows from the live source. With snapshotPath set, every row
+// read is also recorded there; the snapshot only replaces an existing one once the
+// whole source was read, so an interrupted run never leaves a partial snapshot.
+func queryRows(ctx context.Context, srcDB *sql.DB, from, condition string, isolation sql.IsolationLevel, beforeQuery func(*sql.Tx) error, snapshotPath string) (*sourceRows, error) {
+	tx, rows, err := querySourceTable(ctx, srcDB, from, condition, isolation, beforeQuery)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching data from source table: %v", err)
+	}
+	source := &sourceRows{close: func() {
+		rows.Close()
+		tx.Rollback()
+	}}
+
+	source.cols, err = rows.Columns()
+	if err != nil {
+		source.close()
+		return nil, fmt.Errorf("error fetching column information: %v", err)
+	}
+	source.typeNames, err = columnTypeNames(rows)
+	if err != nil {
+		source.close()
+		return nil, fmt.Errorf("error fetching column types: %v", err)
+	}
+
+	var encoder *gob.Encoder
+	var recording *os.File
+	if snapshotPath != "" {
+		recording, err = os.Create(snapshotPath + ".tmp")
+		if err != nil {
+			source.close()
+			return nil, fmt.Errorf("failed to create snapshot: %v", err)
+		}
+		encoder = gob.NewEncoder(recording)
+		if err := encoder.Encode(snapshotHeader{Columns: source.cols, TypeNames: source.typeNames}); err != nil {
+			recording.Close()
+			os.Remove(recording.Name())
+			source.close()
+			return nil, fmt.Errorf("failed to write snapshot header: %v", err)
+		}
+		closeSource := source.close
+		source.close = func() {
+			closeSource()
+			if recording != nil {
+				recording.Close()
+				os.Remove(recording.Name())
+			}
+		}
+	}
+
+	scanner := newRowScanner(source.typeNames)
+	source.next = func() ([]interface{}, error) {
+		if !rows.Next() {
+			if err := rows.Err(); err != nil {
+				return nil, fmt.Errorf("error iterating over rows: %v", err)
+			}
+			return nil, io.EOF
+		}
+		values, err := scanner.scan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %v", err)
+		}
+		if encoder != nil {
+			if err := encoder.Encode(values); err != nil {
+				return nil, fmt.Errorf("failed to write snapshot row: %v", err)
+			}
+		}
+		return values, nil
+	}
+
+	source.finish = func() error {
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("error committing source transaction: %v", err)
+		}
+		if recording == nil {
+			return nil
+		}
+		err := recording.Close()
+		if err == nil {
+			err = os.Rename(recording.Name(), snapshotPath)
+		}
+		recording = nil
+		if err != nil {
+			return fmt.Errorf("failed to save snapshot: %v", err)
+		}
+		progressf("Source rows recorded to snapshot '%s'\n", snapshotPath)
+		return nil
+	}
+	return source, nil
+}
+
+// openSourceRows reads from the snapshot file when one exists and refresh is not set,
+// and from the live source otherwise, recording a snapshot when a path is given
+func openSourceRows(ctx context.Context, srcDB *sql.DB, from, condition string, isolation sql.IsolationLevel, beforeQuery func(*sql.Tx) error, snapshotPath string, refresh bool) (*sourceRows, error) {
+	if snapshotPath != "" && !refresh {
+		_, err := os.Stat(snapshotPath)
+		if err == nil {
+			progressf("Reading source rows from snapshot '%s'\n", snapshotPath)
+			return openSnapshot(snapshotPath)
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to check snapshot: %v", err)
+		}
+	}
+	return queryRows(ctx, srcDB, from, condition, isolation, beforeQuery, snapshotPath)
+}
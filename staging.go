@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// migrateViaStaging copies the source into a fresh dest__staging table and, once the
+// copy succeeds, atomically swaps it in place of the destination table so readers never
+// see a half-populated table. The staging table is dropped if the copy fails.
+func migrateViaStaging(ctx context.Context, srcDB, dstDB *sql.DB, table tablePair, opts migrationOptions) (tableResult, error) {
+	staging := table.dest + "__staging"
+	old := table.dest + "__old"
+
+	// Staging and replaced tables left behind by an earlier failed run are stale, and a
+	// leftover replaced table would fail the swap only after the whole copy
+	if _, err := dstDB.ExecContext(ctx, fmt.Sprintf("DROP TABLE IF EXISTS %s, %s", staging, old)); err != nil {
+		return tableResult{}, fmt.Errorf("error dropping stale staging tables: %v", err)
+	}
+	exists, err := tableExists(dstDB, table.dest)
+	if err != nil {
+		return tableResult{}, fmt.Errorf("error checking table existence: %v", err)
+	}
+	// An existing destination keeps its own layout, including its destination-only and
+	// -setColumn columns, which a table created from the source would lack
+	if exists {
+		if _, err := dstDB.ExecContext(ctx, fmt.Sprintf("CREATE TABLE %s LIKE %s", staging, table.dest)); err != nil {
+			return tableResult{}, fmt.Errorf("error creating staging table: %v", err)
+		}
+	} else if _, err := createDestTable(srcDB, dstDB, table.source, staging, opts); err != nil {
+		return tableResult{}, fmt.Errorf("error creating staging table: %v", err)
+	}
+
+	result := tableResult{created: !exists}
+	result.migrated, result.failed, err = migrateLoad(ctx, srcDB, dstDB, table.source, staging, []bool{true}, opts)
+	if err != nil {
+		dropStaging(dstDB, staging)
+		return result, err
+	}
+
+	if !exists {
+		if _, err := dstDB.ExecContext(ctx, fmt.Sprintf("RENAME TABLE %s TO %s", staging, table.dest)); err != nil {
+			dropStaging(dstDB, staging)
+			return result, fmt.Errorf("error renaming staging table: %v", err)
+		}
+		progressf("Staging table '%s' renamed to '%s'\n", staging, table.dest)
+		return result, nil
+	}
+
+	// Both renames happen in one atomic statement
+	swap := fmt.Sprintf("RENAME TABLE %s TO %s, %s TO %s", table.dest, old, staging, table.dest)
+	if _, err := dstDB.ExecContext(ctx, swap); err != nil {
+		dropStaging(dstDB, staging)
+		return result, fmt.Errorf("error swapping in staging table: %v", err)
+	}
+	progressf("Staging table '%s' swapped in as '%s'\n", staging, table.dest)
+
+	if _, err := dstDB.ExecContext(ctx, fmt.Sprintf("DROP TABLE %s", old)); err != nil {
+		return result, fmt.Errorf("error dropping replaced table '%s': %v", old, err)
+	}
+	return result, nil
+}
+
+// dropStaging drops the staging table of a failed copy or swap. It uses a fresh context,
+// the migration's may already be cancelled.
+func dropStaging(dstDB *sql.DB, staging string) {
+	if _, err := dstDB.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", staging)); err != nil {
+		log.Printf("Error dropping staging table '%s': %v\n", staging, err)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMigrateViaStagingFailedSwap(t *testing.T) {
+	src := openFake(t, &fakeDB{query: func(string, []driver.Value) *fakeRows {
+		return &fakeRows{cols: []string{"id"}, typeNames: []string{"INT"}, rows: [][]driver.Value{{int64(1)}}}
+	}})
+	// The destination exists and the swap is refused
+	dst := &fakeDB{
+		query: func(query string, _ []driver.Value) *fakeRows {
+			if strings.Contains(query, "information_schema.tables") {
+				return &fakeRows{cols: []string{"table_name"}, rows: [][]driver.Value{{"forms"}}}
+			}
+			return nil
+		},
+		exec: func(query string, _ []driver.Value) error {
+			if strings.HasPrefix(query, "RENAME TABLE") {
+				return errors.New("Table 'forms__old' already exists")
+			}
+			return nil
+		},
+	}
+	opts := migrationOptions{rowsMigrated: new(atomic.Int64)}
+	if _, err := migrateViaStaging(context.Background(), src, openFake(t, dst), tablePair{"forms", "forms"}, opts); err == nil {
+		t.Fatal("migrateViaStaging() succeeded, want the swap error")
+	}
+
+	var ddl []string
+	for _, statement := range dst.statements {
+		if strings.HasPrefix(statement, "DROP") || strings.HasPrefix(statement, "CREATE") || strings.HasPrefix(statement, "RENAME") {
+			ddl = append(ddl, statement)
+		}
+	}
+	want := []string{
+		"DROP TABLE IF EXISTS forms__staging, forms__old",
+		"CREATE TABLE forms__staging LIKE forms",
+		"RENAME TABLE forms TO forms__old, forms__staging TO forms",
+		"DROP TABLE IF EXISTS forms__staging",
+	}
+	if !reflect.DeepEqual(ddl, want) {
+		t.Errorf("migrateViaStaging() ran %q, want %q", ddl, want)
+	}
+}
@@ -0,0 +1,514 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// tablePair names a source table and the destination table it is copied into
+type tablePair struct {
+	source string
+	dest   string
+}
+
+// readTablesFile parses a tables file with one "srcTable:dstTable" or "table" per line.
+// Blank lines and lines starting with '#' are ignored.
+func readTablesFile(path string) ([]tablePair, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tables file: %v", err)
+	}
+	defer file.Close()
+
+	var pairs []tablePair
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// A bare table name is copied into a destination table of the same name
+		parts := strings.Split(line, ":")
+		source, dest := parts[0], parts[len(parts)-1]
+		if len(parts) > 2 || source == "" || dest == "" || strings.ContainsAny(line, " \t") {
+			return nil, fmt.Errorf("%s:%d: expected 'srcTable:dstTable' or 'table', got %q", path, lineNumber, line)
+		}
+		pairs = append(pairs, tablePair{source: source, dest: dest})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read tables file: %v", err)
+	}
+
+	return pairs, nil
+}
+
+// excludeTables drops the tables whose source name matches one of the glob patterns,
+// logging each one skipped
+func excludeTables(tables []tablePair, patterns []string) ([]tablePair, error) {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %v", pattern, err)
+		}
+	}
+
+	var kept []tablePair
+tables:
+	for _, table := range tables {
+		for _, pattern := range patterns {
+			if matched, _ := path.Match(pattern, table.source); matched {
+				log.Printf("Skipping table '%s': matches -excludeTables pattern '%s'\n", table.source, pattern)
+				continue tables
+			}
+		}
+		kept = append(kept, table)
+	}
+	return kept, nil
+}
+
+// whereFilters maps source tables to the WHERE condition their rows are filtered by.
+// It implements flag.Value so -whereFor can be repeated.
+type whereFilters map[string]string
+
+func (w whereFilters) String() string {
+	filters := make([]string, 0, len(w))
+	for table, condition := range w {
+		filters = append(filters, table+":"+condition)
+	}
+	return strings.Join(filters, ", ")
+}
+
+func (w whereFilters) Set(value string) error {
+	table, condition, ok := strings.Cut(value, ":")
+	table, condition = strings.TrimSpace(table), strings.TrimSpace(condition)
+	if !ok || table == "" || condition == "" {
+		return fmt.Errorf("expected 'table:condition', got %q", value)
+	}
+	if _, exists := w[table]; exists {
+		return fmt.Errorf("table '%s' already has a filter", table)
+	}
+	w[table] = condition
+	return nil
+}
+
+// stringList collects a repeatable flag in the order given
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, "; ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// sessionVariables collects the repeatable -destSessionVar flag as DSN parameters,
+// which the driver sets with SET on every new connection. Values are used verbatim,
+// so strings must be quoted.
+type sessionVariables url.Values
+
+func (v sessionVariables) String() string {
+	return url.Values(v).Encode()
+}
+
+func (v sessionVariables) Set(value string) error {
+	name, setting, ok := strings.Cut(value, "=")
+	name, setting = strings.TrimSpace(name), strings.TrimSpace(setting)
+	if !ok || !isPlainIdentifier(name) || setting == "" || strings.Contains(setting, ";") {
+		return fmt.Errorf("expected 'name=value' with a single value, got %q", value)
+	}
+	if driverOptions[name] {
+		return fmt.Errorf("'%s' is a driver option, not a session variable", name)
+	}
+	if _, exists := v[name]; exists {
+		return fmt.Errorf("session variable '%s' is already set", name)
+	}
+	v[name] = []string{setting}
+	return nil
+}
+
+// driverOptions are DSN parameters go-sql-driver interprets itself instead of setting
+// them as session variables
+var driverOptions = map[string]bool{
+	"allowAllFiles": true, "allowCleartextPasswords": true, "allowFallbackToPlaintext": true,
+	"allowNativePasswords": true, "allowOldPasswords": true, "charset": true, "checkConnLiveness": true,
+	"clientFoundRows": true, "collation": true, "columnsWithAlias": true, "connectionAttributes": true,
+	"interpolateParams": true, "loc": true, "maxAllowedPacket": true, "multiStatements": true,
+	"parseTime": true, "readTimeout": true, "rejectReadOnly": true, "serverPubKey": true,
+	"timeout": true, "timeTruncate": true, "tls": true, "writeTimeout": true,
+}
+
+// columnValue is a constant inserted into a destination column on every row
+type columnValue struct {
+	column string
+	value  string
+}
+
+// columnValues collects the repeatable -setColumn flag in the order given
+type columnValues []columnValue
+
+func (c *columnValues) String() string {
+	values := make([]string, len(*c))
+	for i, value := range *c {
+		values[i] = value.column + ":" + value.value
+	}
+	return strings.Join(values, ", ")
+}
+
+func (c *columnValues) Set(value string) error {
+	column, constant, ok := strings.Cut(value, ":")
+	column = strings.TrimSpace(column)
+	if !ok || column == "" {
+		return fmt.Errorf("expected 'column:value', got %q", value)
+	}
+	for _, existing := range *c {
+		if existing.column == column {
+			return fmt.Errorf("column '%s' is already set", column)
+		}
+	}
+	*c = append(*c, columnValue{column: column, value: constant})
+	return nil
+}
+
+// splitTableName splits a database-qualified table name for information_schema
+// queries, which compare table_schema with COALESCE(?, DATABASE()): the database is
+// nil for an unqualified name, so the connection's database applies
+func splitTableName(name string) (database interface{}, table string) {
+	if database, table, ok := strings.Cut(name, "."); ok {
+		return database, table
+	}
+	return nil, name
+}
+
+// quoteTableName quotes a table name for SQL, quoting the database of a qualified
+// name on its own
+func quoteTableName(name string) string {
+	if database, table := splitTableName(name); database != nil {
+		return fmt.Sprintf("`%s`.`%s`", database, table)
+	}
+	return fmt.Sprintf("`%s`", name)
+}
+
+// whereClause returns the WHERE clause for a filter condition, or nothing without one
+func whereClause(condition string) string {
+	if condition == "" {
+		return ""
+	}
+	return " WHERE " + condition
+}
+
+// progress receives the banners and per-row output of a migration, -summaryOnly
+// discards it so only the per-table summary lines reach stdout
+var progress io.Writer = os.Stdout
+
+// progressf formats intermediate migration output to progress
+func progressf(format string, args ...interface{}) {
+	fmt.Fprintf(progress, format, args...)
+}
+
+// tableResult describes how the migration of one table went
+type tableResult struct {
+	created  bool
+	migrated int
+	failed   int
+	duration time.Duration
+}
+
+// summaryLine formats the result as a single key=value line for log scraping
+func (r tableResult) summaryLine(table string) string {
+	return fmt.Sprintf("table=%s created=%t migrated=%d failed=%d duration=%.1fs", table, r.created, r.migrated, r.failed, r.duration.Seconds())
+}
+
+// ddlOptions adjusts the DDL generated for destination tables
+type ddlOptions struct {
+	// autoTimestamps columns get DEFAULT CURRENT_TIMESTAMP instead of the source default
+	autoTimestamps []string
+	// defaultOverrides replace the source default of a column, defaultNone drops it
+	defaultOverrides columnValues
+	// typeOverrides replace the source type of a column
+	typeOverrides columnValues
+	// collation replaces the source table collation when set
+	collation string
+	// columnCollations give a column its own collation
+	columnCollations columnValues
+	// stamp is the -stampComment provenance added to table comments when set
+	stamp string
+	// completeSchema adds the missing source indexes and CHECK constraints to existing tables
+	completeSchema bool
+}
+
+// migrationOptions holds the settings applied to every table in a run
+type migrationOptions struct {
+	ddl                ddlOptions
+	isolation          sql.IsolationLevel
+	slowRowThreshold   time.Duration
+	heartbeat          time.Duration
+	nullToDefault      bool
+	rowsPerTransaction int
+	logWarnings        bool
+	strictWarnings     bool
+	stagingSwap        bool
+	lowPriority        bool
+	summaryOnly        bool
+	reportFormat       string
+	skipExisting       bool
+	encryptColumns     []string
+	where              whereFilters
+	sourceQuery        string
+	logFailedSQL       bool
+	deadLetterTable    string
+	onConflict         string
+	keepaliveInterval  time.Duration
+	setColumns         columnValues
+	destInitSQL        []string
+	destFinalizeSQL    []string
+	disableKeys        bool
+	maxRowBytes        int64
+	oversizedRowPolicy string
+	chunkSize          int
+	chunkPause         time.Duration
+	maxAffectedRows    int64
+
+	// snapshotFile caches the source rows between runs, refreshSnapshot records it again
+	snapshotFile    string
+	refreshSnapshot bool
+
+	// shards spreads the rows over these destination databases by key hash when set
+	shards []destShard
+
+	// encryptor encrypts the values of encryptColumns when set
+	encryptor Encryptor
+
+	// binlogPositions collects the source binlog position and executed GTID set of each
+	// table when set, as captureBinlogPos and captureGTID ask
+	binlogPositions  *binlogPositions
+	captureBinlogPos bool
+	captureGTID      bool
+
+	// lockName prefixes the advisory lock held on each destination table when set,
+	// waiting up to lockTimeout for other runs to release it
+	lockName    string
+	lockTimeout time.Duration
+
+	// replicaLag pauses inserts while the monitored replica lags when set
+	replicaLag *lagThrottle
+
+	// manifest records the state of each table when set
+	manifest *migrationManifest
+
+	// progressEvents receives the -progressJSON event stream when set
+	progressEvents *progressEmitter
+
+	// rowsMigrated counts rows inserted across all tables of the run
+	rowsMigrated *atomic.Int64
+}
+
+// migrateTable creates the destination table if needed and copies the source rows into it.
+// With -destShards the table is created on every shard.
+func migrateTable(ctx context.Context, srcDB, dstDB *sql.DB, table tablePair, opts migrationOptions) (tableResult, error) {
+	start := time.Now()
+	dests := destinations(dstDB, opts)
+	if opts.lockName != "" {
+		for _, db := range dests {
+			release, err := acquireTableLock(ctx, db, opts.lockName, table.dest, opts.lockTimeout)
+			if err != nil {
+				return tableResult{duration: time.Since(start)}, err
+			}
+			defer release()
+		}
+	}
+	if opts.stagingSwap {
+		result, err := migrateViaStaging(ctx, srcDB, dstDB, table, opts)
+		result.duration = time.Since(start)
+		return result, err
+	}
+
+	// Check if the destination table exists, and create it if not
+	var result tableResult
+	created := make([]bool, len(dests))
+	for i, db := range dests {
+		var err error
+		created[i], err = createDestTable(srcDB, db, table.source, table.dest, opts)
+		if err != nil {
+			result.duration = time.Since(start)
+			return result, fmt.Errorf("error creating table: %v", err)
+		}
+		result.created = result.created || created[i]
+	}
+
+	// Perform data migration
+	var err error
+	result.migrated, result.failed, err = migrateLoad(ctx, srcDB, dstDB, table.source, table.dest, created, opts)
+	result.duration = time.Since(start)
+	return result, err
+}
+
+// migrateLoad runs migrateData, deferring index maintenance with -disableKeysDuringLoad
+// on the destinations where the table was just created. The keys of existing tables are
+// never disabled.
+func migrateLoad(ctx context.Context, srcDB, dstDB *sql.DB, sourceTable, destTable string, created []bool, opts migrationOptions) (int, int, error) {
+	var enablers []func() error
+	if opts.disableKeys {
+		for i, db := range destinations(dstDB, opts) {
+			if !created[i] {
+				continue
+			}
+			enableKeys, err := disableKeys(db, destTable)
+			if err != nil {
+				restoreKeys(enablers)
+				return 0, 0, err
+			}
+			enablers = append(enablers, enableKeys)
+		}
+	}
+	if len(enablers) == 0 {
+		return migrateData(ctx, srcDB, dstDB, sourceTable, destTable, opts)
+	}
+
+	migrated, failed, err := migrateData(ctx, srcDB, dstDB, sourceTable, destTable, opts)
+	if enableErr := restoreKeys(enablers); enableErr != nil {
+		if err != nil {
+			log.Printf("Error restoring indexes after the failed copy: %v\n", enableErr)
+			return migrated, failed, err
+		}
+		return migrated, failed, enableErr
+	}
+	return migrated, failed, err
+}
+
+// restoreKeys runs every enableKeys function, returning the first error
+func restoreKeys(enablers []func() error) error {
+	var firstErr error
+	for _, enableKeys := range enablers {
+		if err := enableKeys(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// createDestTable creates the destination table if it does not exist, from the source
+// table or the -sourceQuery result, reporting whether it was created
+func createDestTable(srcDB, dstDB *sql.DB, source, dest string, opts migrationOptions) (bool, error) {
+	if opts.sourceQuery != "" {
+		return createTableFromQuery(srcDB, dstDB, opts.sourceQuery, dest)
+	}
+	return createTableIfNotExists(srcDB, dstDB, source, dest, opts.ddl)
+}
+
+// migrateTables migrates the given tables using up to concurrency workers. With
+// stopOnError, the first failure cancels the tables still in flight and stops the run.
+// It returns the number of rows migrated across all tables.
+func migrateTables(ctx context.Context, srcDB, dstDB *sql.DB, tables []tablePair, concurrency int, stopOnError bool, opts migrationOptions) (int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	opts.rowsMigrated = new(atomic.Int64)
+	if opts.heartbeat > 0 {
+		stop := startHeartbeat(ctx, opts.heartbeat, opts.rowsMigrated)
+		defer stop()
+	}
+
+	var (
+		mu        sync.Mutex
+		firstErr  error
+		failed    []string
+		totalRows int
+		migrated  int
+		reports   = make([]*tableReport, len(tables))
+	)
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				table := tables[index]
+				opts.manifest.update(table, manifestInProgress, tableResult{}, nil)
+				result, err := migrateTable(ctx, srcDB, dstDB, table, opts)
+				if err != nil {
+					opts.manifest.update(table, manifestFailed, result, err)
+				} else {
+					opts.manifest.update(table, manifestDone, result, nil)
+				}
+
+				done := progressEvent{Event: "table_done", Table: table.source, Migrated: int64(result.migrated), Failed: int64(result.failed)}
+				if err != nil {
+					done.Error = err.Error()
+				}
+				opts.progressEvents.emit(done)
+
+				report := result.report(table, err)
+				mu.Lock()
+				reports[index] = &report
+				totalRows += result.migrated
+				if opts.summaryOnly {
+					fmt.Println(result.summaryLine(table.source))
+				}
+				if err != nil {
+					log.Printf("Error migrating '%s' to '%s': %v\n", table.source, table.dest, err)
+					failed = append(failed, table.source)
+					if firstErr == nil {
+						firstErr = fmt.Errorf("table '%s': %v", table.source, err)
+					}
+					if stopOnError {
+						cancel()
+					}
+				} else {
+					migrated++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for index := range tables {
+		select {
+		case jobs <- index:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	done := progressEvent{Event: "done", Migrated: int64(totalRows)}
+	if len(failed) > 0 {
+		done.Error = fmt.Sprintf("%d table(s) failed", len(failed))
+	}
+	opts.progressEvents.emit(done)
+	if len(tables) > 1 {
+		progressf("Migrated %d of %d tables (%d rows in total)\n", migrated, len(tables), totalRows)
+	}
+	// Tables a cancelled run never started are left out of the report
+	var finished []tableReport
+	for _, report := range reports {
+		if report != nil {
+			finished = append(finished, *report)
+		}
+	}
+	if err := writeReport(os.Stdout, opts.reportFormat, finished); err != nil {
+		log.Printf("Error writing report: %v\n", err)
+	}
+	if len(failed) > 0 {
+		return totalRows, fmt.Errorf("%d table(s) failed (%s), first error: %v", len(failed), strings.Join(failed, ", "), firstErr)
+	}
+	return totalRows, nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExcludeTables(t *testing.T) {
+	tables := []tablePair{{"forms", "forms"}, {"forms_log", "forms_log"}, {"cache_users", "cache_users"}, {"users", "users"}}
+	tests := []struct {
+		patterns []string
+		want     []tablePair
+	}{
+		{nil, tables},
+		{[]string{"*_log"}, []tablePair{{"forms", "forms"}, {"cache_users", "cache_users"}, {"users", "users"}}},
+		{[]string{"*_log", "cache_*"}, []tablePair{{"forms", "forms"}, {"users", "users"}}},
+		{[]string{"users"}, []tablePair{{"forms", "forms"}, {"forms_log", "forms_log"}, {"cache_users", "cache_users"}}},
+		{[]string{"*"}, nil},
+	}
+	for _, tt := range tests {
+		got, err := excludeTables(tables, tt.patterns)
+		if err != nil {
+			t.Fatalf("excludeTables(%q) error = %v", tt.patterns, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("excludeTables(%q) = %v, want %v", tt.patterns, got, tt.want)
+		}
+	}
+
+	if _, err := excludeTables(tables, []string{"forms["}); err == nil {
+		t.Error("excludeTables() with a malformed pattern succeeded, want an error")
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// tracingDriverName is the driver -trace opens connections with instead of "mysql"
+const tracingDriverName = "mysql-trace"
+
+// maxTracedStatement is the length statements are cut to in trace lines, batched
+// inserts would otherwise log thousands of placeholders
+const maxTracedStatement = 300
+
+func init() {
+	sql.Register(tracingDriverName, tracingDriver{mysql.MySQLDriver{}})
+}
+
+// traceStatement logs one trace line for a statement that started at start. rows is
+// the number of affected rows of an exec, or negative when there is none.
+func traceStatement(statement string, start time.Time, rows int64, err error) {
+	statement = strings.Join(strings.Fields(statement), " ")
+	if len(statement) > maxTracedStatement {
+		statement = statement[:maxTracedStatement] + "..."
+	}
+	line := statement
+	if rows >= 0 {
+		line += " rows=" + strconv.FormatInt(rows, 10)
+	}
+	if err != nil {
+		line += " error=" + err.Error()
+	}
+	log.Printf("trace: %8.2fms %s\n", float64(time.Since(start).Microseconds())/1000, line)
+}
+
+// tracingDriver wraps the MySQL driver so every statement, prepared statement execution
+// and transaction end is logged with its duration. Only -trace opens connections with it,
+// so runs without the flag pay nothing.
+type tracingDriver struct {
+	driver.Driver
+}
+
+func (d tracingDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return tracedConn{conn}, nil
+}
+
+// tracedConn forwards to the MySQL connection, logging the statements it runs. The
+// optional interfaces database/sql checks for are forwarded too, so connection reuse
+// and argument conversion behave as without tracing.
+type tracedConn struct {
+	driver.Conn
+}
+
+func (c tracedConn) Prepare(query string) (driver.Stmt, error) {
+	stmt, err := c.Conn.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return tracedStmt{stmt, query}, nil
+}
+
+func (c tracedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	preparer, ok := c.Conn.(driver.ConnPrepareContext)
+	if !ok {
+		return c.Prepare(query)
+	}
+	stmt, err := preparer.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return tracedStmt{stmt, query}, nil
+}
+
+func (c tracedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	start := time.Now()
+	var tx driver.Tx
+	var err error
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		tx, err = beginner.BeginTx(ctx, opts)
+	} else {
+		tx, err = c.Conn.Begin()
+	}
+	traceStatement("BEGIN", start, -1, err)
+	if err != nil {
+		return nil, err
+	}
+	return tracedTx{tx}, nil
+}
+
+func (c tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	result, err := execer.ExecContext(ctx, query, args)
+	// Skipped statements are run and traced as prepared statements instead
+	if err == driver.ErrSkip {
+		return nil, err
+	}
+	traceStatement(query, start, affectedRows(result), err)
+	return result, err
+}
+
+func (c tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	if err == driver.ErrSkip {
+		return nil, err
+	}
+	traceStatement(query, start, -1, err)
+	return rows, err
+}
+
+func (c tracedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c tracedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c tracedConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (c tracedConn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+// tracedStmt logs the executions of a prepared statement
+type tracedStmt struct {
+	driver.Stmt
+	query string
+}
+
+func (s tracedStmt) Exec(args []driver.Value) (driver.Result, error) {
+	start := time.Now()
+	result, err := s.Stmt.Exec(args)
+	traceStatement(s.query, start, affectedRows(result), err)
+	return result, err
+}
+
+func (s tracedStmt) Query(args []driver.Value) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := s.Stmt.Query(args)
+	traceStatement(s.query, start, -1, err)
+	return rows, err
+}
+
+func (s tracedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := s.Stmt.(driver.StmtExecContext)
+	if !ok {
+		return s.Exec(namedValues(args))
+	}
+	start := time.Now()
+	result, err := execer.ExecContext(ctx, args)
+	traceStatement(s.query, start, affectedRows(result), err)
+	return result, err
+}
+
+func (s tracedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := s.Stmt.(driver.StmtQueryContext)
+	if !ok {
+		return s.Query(namedValues(args))
+	}
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, args)
+	traceStatement(s.query, start, -1, err)
+	return rows, err
+}
+
+// tracedTx logs how a transaction ended
+type tracedTx struct {
+	driver.Tx
+}
+
+func (t tracedTx) Commit() error {
+	start := time.Now()
+	err := t.Tx.Commit()
+	traceStatement("COMMIT", start, -1, err)
+	return err
+}
+
+func (t tracedTx) Rollback() error {
+	start := time.Now()
+	err := t.Tx.Rollback()
+	traceStatement("ROLLBACK", start, -1, err)
+	return err
+}
+
+// affectedRows returns the affected rows of a result, or -1 without one
+func affectedRows(result driver.Result) int64 {
+	if result == nil {
+		return -1
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return -1
+	}
+	return rows
+}
+
+// namedValues drops the names and ordinals of statement arguments
+func namedValues(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
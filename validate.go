@@ -0,0 +1,211 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// columnInfo describes a table column as reported by information_schema.columns
+type columnInfo struct {
+	name         string
+	columnType   string
+	nullable     bool
+	defaultValue sql.NullString
+	extra        string
+	collation    sql.NullString
+	comment      string
+}
+
+// getColumns returns the columns of a table in ordinal order
+func getColumns(db *sql.DB, tableName string) ([]columnInfo, error) {
+	query := `SELECT column_name, column_type, is_nullable, column_default, extra, collation_name, column_comment
+		FROM information_schema.columns
+		WHERE table_schema = COALESCE(?, DATABASE()) AND table_name = ?
+		ORDER BY ordinal_position`
+	schema, table := splitTableName(tableName)
+	rows, err := db.Query(query, schema, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query columns: %v", err)
+	}
+	defer rows.Close()
+
+	var columns []columnInfo
+	for rows.Next() {
+		var column columnInfo
+		var nullable string
+		if err := rows.Scan(&column.name, &column.columnType, &nullable, &column.defaultValue, &column.extra, &column.collation, &column.comment); err != nil {
+			return nil, fmt.Errorf("failed to scan column: %v", err)
+		}
+		column.nullable = nullable == "YES"
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
+
+// tableExists reports whether the table exists in its database, the connection's unless qualified
+func tableExists(db *sql.DB, tableName string) (bool, error) {
+	var name string
+	query := "SELECT table_name FROM information_schema.tables WHERE table_schema = COALESCE(?, DATABASE()) AND table_name = ?"
+	schema, table := splitTableName(tableName)
+	err := db.QueryRow(query, schema, table).Scan(&name)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// requiresValue reports whether an insert that omits the column fails in strict mode:
+// it is NOT NULL and neither has a default nor is filled in by the server
+func requiresValue(column columnInfo) bool {
+	extra := strings.ToLower(column.extra)
+	return !column.nullable && !column.defaultValue.Valid &&
+		!strings.Contains(extra, "auto_increment") && !strings.Contains(extra, "generated")
+}
+
+// compareColumns lists the differences that would break copying source rows into
+// the destination table by column name. Collations are compared with
+// collationsCompatible unless ignoreCollation is set.
+func compareColumns(srcColumns, destColumns []columnInfo, destServer serverInfo, ignoreCollation bool) []string {
+	var problems []string
+
+	destByName := make(map[string]columnInfo, len(destColumns))
+	for _, column := range destColumns {
+		destByName[column.name] = column
+	}
+	srcNames := make(map[string]bool, len(srcColumns))
+
+	for _, src := range srcColumns {
+		srcNames[src.name] = true
+		dest, ok := destByName[src.name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("column '%s' is missing in destination", src.name))
+			continue
+		}
+		if src.columnType != dest.columnType {
+			problems = append(problems, fmt.Sprintf("column '%s' is %s in source but %s in destination", src.name, src.columnType, dest.columnType))
+		}
+		if !ignoreCollation && src.collation.Valid && dest.collation.Valid && !collationsCompatible(src.collation.String, dest.collation.String, destServer) {
+			problems = append(problems, fmt.Sprintf("column '%s' has collation %s in source but %s in destination", src.name, src.collation.String, dest.collation.String))
+		}
+	}
+	// Destination-only columns are left out of the insert and take their defaults
+	for _, dest := range destColumns {
+		if !srcNames[dest.name] && requiresValue(dest) {
+			problems = append(problems, fmt.Sprintf("column '%s' exists only in destination and is NOT NULL without a default", dest.name))
+		}
+	}
+
+	return problems
+}
+
+// validateTable runs the preflight checks for one table pair and returns the problems found
+func validateTable(srcDB, dstDB *sql.DB, table tablePair, ddl ddlOptions, ignoreCollation bool) ([]string, error) {
+	exists, err := tableExists(srcDB, table.source)
+	if err != nil {
+		return nil, fmt.Errorf("error checking source table existence: %v", err)
+	}
+	if !exists {
+		return []string{fmt.Sprintf("source table '%s' does not exist", table.source)}, nil
+	}
+
+	exists, err = tableExists(dstDB, table.dest)
+	if err != nil {
+		return nil, fmt.Errorf("error checking destination table existence: %v", err)
+	}
+	destServer, err := detectServer(dstDB)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		// The destination table would be created, so check its DDL can be generated
+		if _, err := buildCreateTableSQL(srcDB, table.source, table.dest, ddl, destServer); err != nil {
+			return []string{err.Error()}, nil
+		}
+		return nil, nil
+	}
+
+	srcColumns, err := getColumns(srcDB, table.source)
+	if err != nil {
+		return nil, err
+	}
+	destColumns, err := getColumns(dstDB, table.dest)
+	if err != nil {
+		return nil, err
+	}
+	return compareColumns(srcColumns, destColumns, destServer, ignoreCollation), nil
+}
+
+// checkColumnOptions returns the problems with the columns -retype and -setColumn name,
+// given the sources rows are read from: a -retype column none of them has would be
+// ignored, and a -setColumn column one of them has fails the copy of that table
+func checkColumnOptions(srcDB *sql.DB, sources []string, typeOverrides, setColumns columnValues) ([]string, error) {
+	if len(typeOverrides) == 0 && len(setColumns) == 0 {
+		return nil, nil
+	}
+	retyped := make(map[string]bool, len(typeOverrides))
+	var problems []string
+	for _, source := range sources {
+		columnTypes, err := getColumnTypes(srcDB, source)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching columns of '%s': %v", source, err)
+		}
+		for _, override := range typeOverrides {
+			if _, ok := columnTypes[override.column]; ok {
+				retyped[override.column] = true
+			}
+		}
+		for _, constant := range setColumns {
+			if _, ok := columnTypes[constant.column]; ok {
+				problems = append(problems, fmt.Sprintf("-setColumn column '%s' is also a column of source '%s'", constant.column, source))
+			}
+		}
+	}
+	for _, override := range typeOverrides {
+		if !retyped[override.column] {
+			problems = append(problems, fmt.Sprintf("-retype column '%s' is not a column of any source table", override.column))
+		}
+	}
+	return problems, nil
+}
+
+// validateTables runs the preflight checks for every table pair without copying or
+// creating anything, printing a consolidated report. It reports whether all passed.
+func validateTables(srcDB, dstDB *sql.DB, tables []tablePair, ddl ddlOptions, setColumns columnValues, ignoreCollation bool) bool {
+	sources := make([]string, len(tables))
+	for i, table := range tables {
+		sources[i] = table.source
+	}
+	problems, err := checkColumnOptions(srcDB, sources, ddl.typeOverrides, setColumns)
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	optionsPassed := len(problems) == 0
+	if !optionsPassed {
+		fmt.Printf("FAIL column options\n")
+		for _, problem := range problems {
+			fmt.Printf("  - %s\n", problem)
+		}
+	}
+
+	passed := 0
+	for _, table := range tables {
+		problems, err := validateTable(srcDB, dstDB, table, ddl, ignoreCollation)
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+
+		if len(problems) == 0 {
+			fmt.Printf("PASS %s -> %s\n", table.source, table.dest)
+			passed++
+			continue
+		}
+		fmt.Printf("FAIL %s -> %s\n", table.source, table.dest)
+		for _, problem := range problems {
+			fmt.Printf("  - %s\n", problem)
+		}
+	}
+
+	fmt.Printf("Validation: %d of %d tables passed\n", passed, len(tables))
+	return optionsPassed && passed == len(tables)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckColumnOptions(t *testing.T) {
+	src := openFake(t, &fakeDB{query: func(query string, _ []driver.Value) *fakeRows {
+		if strings.Contains(query, "FROM users ") {
+			return &fakeRows{cols: []string{"id", "email"}}
+		}
+		return &fakeRows{cols: []string{"id", "notes"}}
+	}})
+	sources := []string{"forms", "users"}
+
+	tests := []struct {
+		typeOverrides columnValues
+		setColumns    columnValues
+		want          []string
+	}{
+		{nil, nil, nil},
+		// A column of any one table can be retyped
+		{columnValues{{column: "notes", value: "TEXT"}, {column: "email", value: "VARCHAR(320)"}}, columnValues{{column: "tenant_id", value: "42"}}, nil},
+		{columnValues{{column: "note", value: "TEXT"}}, nil, []string{"-retype column 'note' is not a column of any source table"}},
+		{nil, columnValues{{column: "email", value: "x"}}, []string{"-setColumn column 'email' is also a column of source 'users'"}},
+	}
+	for _, tt := range tests {
+		got, err := checkColumnOptions(src, sources, tt.typeOverrides, tt.setColumns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("checkColumnOptions(%v, %v) = %q, want %q", tt.typeOverrides, tt.setColumns, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// destWriter executes the prepared insert statement on a dedicated destination
+// connection. With a transaction size it groups inserts into transactions of at most
+// that many rows; otherwise every insert autocommits.
+type destWriter struct {
+	conn    *sql.Conn
+	stmt    *sql.Stmt
+	txSize  int
+	tx      *sql.Tx
+	txStmt  *sql.Stmt
+	pending int
+
+	// finalizeSQL undoes the -destInitSQL session settings unless finalize already ran it
+	finalizeSQL []string
+	finalized   bool
+}
+
+// openDestWriter acquires a dedicated connection on db, since inserts, their transactions
+// and SHOW WARNINGS must share one, runs -destInitSQL on it and prepares the insert.
+// close undoes the session settings with -destFinalizeSQL before the connection returns
+// to the pool, even when the copy fails.
+func openDestWriter(ctx context.Context, db *sql.DB, insertStmt string, opts migrationOptions) (*destWriter, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error acquiring destination connection: %v", err)
+	}
+	if err := execStatements(ctx, conn, opts.destInitSQL); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error running -destInitSQL: %v", err)
+	}
+	w := &destWriter{conn: conn, txSize: opts.rowsPerTransaction, finalizeSQL: opts.destFinalizeSQL}
+	w.stmt, err = conn.PrepareContext(ctx, insertStmt)
+	if err != nil {
+		w.close()
+		return nil, fmt.Errorf("error preparing insert statement: %v", err)
+	}
+	return w, nil
+}
+
+// finalize runs -destFinalizeSQL once the copy is done
+func (w *destWriter) finalize(ctx context.Context) error {
+	w.finalized = true
+	if err := execStatements(ctx, w.conn, w.finalizeSQL); err != nil {
+		return fmt.Errorf("error running -destFinalizeSQL: %v", err)
+	}
+	return nil
+}
+
+// close discards the open transaction, runs -destFinalizeSQL unless finalize did and
+// releases the connection
+func (w *destWriter) close() {
+	w.rollback()
+	if !w.finalized {
+		if err := execStatements(context.Background(), w.conn, w.finalizeSQL); err != nil {
+			log.Printf("Error running -destFinalizeSQL: %v\n", err)
+		}
+	}
+	if w.stmt != nil {
+		w.stmt.Close()
+	}
+	w.conn.Close()
+}
+
+// exec runs the insert, beginning a new transaction first if one is due
+func (w *destWriter) exec(ctx context.Context, args ...interface{}) (sql.Result, error) {
+	if w.txSize <= 0 {
+		return w.stmt.ExecContext(ctx, args...)
+	}
+	if w.tx == nil {
+		tx, err := w.conn.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to begin destination transaction: %v", err)
+		}
+		w.tx = tx
+		w.txStmt = tx.StmtContext(ctx, w.stmt)
+	}
+	return w.txStmt.ExecContext(ctx, args...)
+}
+
+// rowDone records a successful insert and commits once the transaction is full
+func (w *destWriter) rowDone() error {
+	if w.txSize <= 0 {
+		return nil
+	}
+	w.pending++
+	if w.pending >= w.txSize {
+		return w.commit()
+	}
+	return nil
+}
+
+// commit commits the open transaction, if any. On failure the transaction is kept so
+// rollback can report the rows lost with it.
+func (w *destWriter) commit() error {
+	if w.tx == nil {
+		return nil
+	}
+	if err := w.tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit destination transaction: %v", err)
+	}
+	w.tx, w.txStmt, w.pending = nil, nil, 0
+	return nil
+}
+
+// rollback discards the open transaction and returns the number of rows lost with it
+func (w *destWriter) rollback() int {
+	if w.tx == nil {
+		return 0
+	}
+	lost := w.pending
+	w.tx.Rollback()
+	w.tx, w.txStmt, w.pending = nil, nil, 0
+	return lost
+}
+
+// destWriters are the writers of one table's destinations, one per -destShards shard
+type destWriters []*destWriter
+
+// commit commits the open transaction of every writer
+func (ws destWriters) commit() error {
+	for _, w := range ws {
+		if err := w.commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollback discards the open transactions and returns the number of rows lost with them
+func (ws destWriters) rollback() int {
+	lost := 0
+	for _, w := range ws {
+		lost += w.rollback()
+	}
+	return lost
+}
+
+// finalize runs -destFinalizeSQL on every writer's connection
+func (ws destWriters) finalize(ctx context.Context) error {
+	for _, w := range ws {
+		if err := w.finalize(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// close closes every writer
+func (ws destWriters) close() {
+	for _, w := range ws {
+		w.close()
+	}
+}
+
+// warnings returns the warnings raised by the last statement on the writer's connection
+func (w *destWriter) warnings(ctx context.Context) ([]string, error) {
+	var rows *sql.Rows
+	var err error
+	if w.tx != nil {
+		rows, err = w.tx.QueryContext(ctx, "SHOW WARNINGS")
+	} else {
+		rows, err = w.conn.QueryContext(ctx, "SHOW WARNINGS")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query warnings: %v", err)
+	}
+	defer rows.Close()
+
+	var warnings []string
+	for rows.Next() {
+		var level, message string
+		var code int
+		if err := rows.Scan(&level, &code, &message); err != nil {
+			return nil, fmt.Errorf("failed to scan warning: %v", err)
+		}
+		warnings = append(warnings, fmt.Sprintf("%s %d: %s", level, code, message))
+	}
+	return warnings, rows.Err()
+}
+
+// execStatements runs each statement on the connection in order, stopping at the first error
+func execStatements(ctx context.Context, conn *sql.Conn, statements []string) error {
+	for _, statement := range statements {
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("%s: %v", statement, err)
+		}
+	}
+	return nil
+}